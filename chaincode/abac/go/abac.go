@@ -20,7 +20,6 @@ import (
 	"fmt"
 	"strconv"
 
-	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
 	"github.com/hyperledger/fabric-chaincode-go/shim"
 	pb "github.com/hyperledger/fabric-protos-go/peer"
 )
@@ -36,10 +35,18 @@ func (t *SimpleChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
 
 	//
 	// Demonstrate the use of Attribute-Based Access Control (ABAC) by checking
-	// to see if the caller has the "abac.init" attribute with a value of true;
+	// to see if the caller has the "initializer" role, which the default role
+	// mappings derive from the "abac.init" attribute with a value of true;
 	// if not, return an error.
 	//
-	err := cid.AssertAttributeValue(stub, "abac.init", "true")
+	err := assertRole(stub, "initializer")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// The org that first initializes the chaincode owns it: the default role
+	// mappings only grant roles to its members from then on.
+	err = claimOwnerMSP(stub)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
@@ -82,6 +89,14 @@ func (t *SimpleChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
 func (t *SimpleChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
 	fmt.Println("abac Invoke")
 	function, args := stub.GetFunctionAndParameters()
+	if err := checkAccess(stub, function); err != nil {
+		return shim.Error(err.Error())
+	}
+	if rule, ok := privilegedFunctions[function]; ok {
+		// Privileged functions only run once enough approvers agree
+		return t.propose(stub, function, args, rule)
+	}
+
 	if function == "invoke" {
 		// Make payment of X units from A to B
 		return t.invoke(stub, args)
@@ -91,9 +106,30 @@ func (t *SimpleChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
 	} else if function == "query" {
 		// the old "Query" is now implemtned in invoke
 		return t.query(stub, args)
-	}
-
-	return shim.Error("Invalid invoke function name. Expecting \"invoke\" \"delete\" \"query\"")
+	} else if function == "delegate" {
+		// Grants another identity temporary access to a restricted function
+		return t.delegate(stub, args)
+	} else if function == "revokeDelegation" {
+		return t.revokeDelegation(stub, args)
+	} else if function == "listDelegations" {
+		return t.listDelegations(stub, args)
+	} else if function == "approve" {
+		// Approves a pending call to a privileged function
+		return t.approve(stub, args)
+	} else if function == "execute" {
+		return t.execute(stub, args)
+	} else if function == "getProposal" {
+		return t.getProposal(stub, args)
+	} else if function == "setRoleMappings" {
+		// Replaces the table deriving roles from MSP ID, OU and attributes
+		return t.setRoleMappings(stub, args)
+	} else if function == "getRoleMappings" {
+		return t.getRoleMappings(stub, args)
+	} else if function == "getRoles" {
+		return t.getRoles(stub, args)
+	}
+
+	return shim.Error("Invalid invoke function name. Expecting \"invoke\" \"delete\" \"query\" \"delegate\" \"revokeDelegation\" \"listDelegations\" \"approve\" \"execute\" \"getProposal\" \"setRoleMappings\" \"getRoleMappings\" \"getRoles\"")
 }
 
 // Transaction makes payment of X units from A to B
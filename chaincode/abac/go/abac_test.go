@@ -10,32 +10,24 @@ import (
 	"fmt"
 	"testing"
 
-	"github.com/gogo/protobuf/proto"
 	"github.com/hyperledger/fabric-chaincode-go/shim"
 	"github.com/hyperledger/fabric-chaincode-go/shimtest"
-	"github.com/hyperledger/fabric-protos-go/msp"
 )
 
-// Cert with attribute. "abac.init":"true"
-const certWithAttrs = `-----BEGIN CERTIFICATE-----
-MIIC2TCCAn+gAwIBAgIUQ0IZAeWJyRqPFpcFshvpVbY1RzMwCgYIKoZIzj0EAwIw
-ZjELMAkGA1UEBhMCVVMxFzAVBgNVBAgTDk5vcnRoIENhcm9saW5hMRQwEgYDVQQK
-EwtIeXBlcmxlZGdlcjEPMA0GA1UECxMGY2xpZW50MRcwFQYDVQQDEw5yY2Etb3Jn
-MS1hZG1pbjAeFw0xODExMTMxNzQ4MDBaFw0xOTExMTMxNzUzMDBaMG8xCzAJBgNV
-BAYTAlVTMRcwFQYDVQQIEw5Ob3J0aCBDYXJvbGluYTEUMBIGA1UEChMLSHlwZXJs
-ZWRnZXIxHDANBgNVBAsTBmNsaWVudDALBgNVBAsTBG9yZzExEzARBgNVBAMTCmFk
-bWluLW9yZzEwWTATBgcqhkjOPQIBBggqhkjOPQMBBwNCAAR196Xv7te+C5gkz7Ui
-h8t2gl8QjjSs6iOLFTk18IEH5vLh+DovGT9q3ylvZpExtOap5zFkCva9GnChxP05
-4A0eo4IBADCB/TAOBgNVHQ8BAf8EBAMCB4AwDAYDVR0TAQH/BAIwADAdBgNVHQ4E
-FgQUXf9wjawRl/KosmHcVnYB4ay8IqswHwYDVR0jBBgwFoAUwqQ3h+jBjt2e2wC1
-f1amDdCHY7QwFwYDVR0RBBAwDoIMZjExN2MxODEyYzM3MIGDBggqAwQFBgcIAQR3
-eyJhdHRycyI6eyJhYmFjLmluaXQiOiJ0cnVlIiwiYWRtaW4iOiJ0cnVlIiwiaGYu
-QWZmaWxpYXRpb24iOiJvcmcxIiwiaGYuRW5yb2xsbWVudElEIjoiYWRtaW4tb3Jn
-MSIsImhmLlR5cGUiOiJjbGllbnQifX0wCgYIKoZIzj0EAwIDSAAwRQIhAN1v/XK0
-WmZf5u9X9FG5uGxwcJ9d5K/eFAC7KahSbs65AiB/GzS2u1cYznXzTDWoBm9oflxY
-w8Ou1Sh9IjeXj/SDAA==
------END CERTIFICATE-----
-`
+// adminIdentity carries the attributes of the org1 admin enrolled by the
+// sample network, including "abac.init":"true".
+var adminIdentity = testIdentity{
+	MSPID:      "org1MSP",
+	CommonName: "admin-org1",
+	OUs:        []string{"client", "org1"},
+	Attrs: map[string]string{
+		"abac.init":       "true",
+		"admin":           "true",
+		"hf.Affiliation":  "org1",
+		"hf.EnrollmentID": "admin-org1",
+		"hf.Type":         "client",
+	},
+}
 
 func checkInit(t *testing.T, stub *shimtest.MockStub, args [][]byte) {
 	res := stub.MockInit("1", args)
@@ -81,20 +73,11 @@ func checkInvoke(t *testing.T, stub *shimtest.MockStub, args [][]byte) {
 	}
 }
 
-func setCreator(t *testing.T, stub *shimtest.MockStub, mspID string, idbytes []byte) {
-	sid := &msp.SerializedIdentity{Mspid: mspID, IdBytes: idbytes}
-	b, err := proto.Marshal(sid)
-	if err != nil {
-		t.FailNow()
-	}
-	stub.Creator = b
-}
-
 func TestAbac_Init(t *testing.T) {
 	scc := new(SimpleChaincode)
 	stub := shimtest.NewMockStub("abac", scc)
 
-	setCreator(t, stub, "org1MSP", []byte(certWithAttrs))
+	newTestCA(t).setIdentity(t, stub, adminIdentity)
 
 	// Init A=123 B=234
 	checkInit(t, stub, [][]byte{[]byte("init"), []byte("A"), []byte("123"), []byte("B"), []byte("234")})
@@ -107,7 +90,7 @@ func TestAbac_Query(t *testing.T) {
 	scc := new(SimpleChaincode)
 	stub := shimtest.NewMockStub("abac", scc)
 
-	setCreator(t, stub, "org1MSP", []byte(certWithAttrs))
+	newTestCA(t).setIdentity(t, stub, adminIdentity)
 
 	// Init A=345 B=456
 	checkInit(t, stub, [][]byte{[]byte("init"), []byte("A"), []byte("345"), []byte("B"), []byte("456")})
@@ -123,7 +106,7 @@ func TestAbac_Invoke(t *testing.T) {
 	scc := new(SimpleChaincode)
 	stub := shimtest.NewMockStub("abac", scc)
 
-	setCreator(t, stub, "org1MSP", []byte(certWithAttrs))
+	newTestCA(t).setIdentity(t, stub, adminIdentity)
 
 	// Init A=567 B=678
 	checkInit(t, stub, [][]byte{[]byte("init"), []byte("A"), []byte("567"), []byte("B"), []byte("678")})
@@ -140,3 +123,30 @@ func TestAbac_Invoke(t *testing.T) {
 	checkQuery(t, stub, "A", "678")
 	checkQuery(t, stub, "B", "567")
 }
+
+func TestAbac_InitAccess(t *testing.T) {
+	ca := newTestCA(t)
+
+	tests := []struct {
+		name  string
+		id    testIdentity
+		allow bool
+	}{
+		{"with abac.init", adminIdentity, true},
+		{"abac.init false", testIdentity{MSPID: "org1MSP", CommonName: "user1", Attrs: map[string]string{"abac.init": "false"}}, false},
+		{"no attributes", testIdentity{MSPID: "org1MSP", CommonName: "user2"}, false},
+		{"other attributes", testIdentity{MSPID: "org2MSP", CommonName: "user3", Attrs: map[string]string{"admin": "true"}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := shimtest.NewMockStub("abac", new(SimpleChaincode))
+			ca.setIdentity(t, stub, tt.id)
+
+			res := stub.MockInit("1", [][]byte{[]byte("init"), []byte("A"), []byte("1"), []byte("B"), []byte("2")})
+			if allowed := res.Status == shim.OK; allowed != tt.allow {
+				t.Fatalf("expected allow=%t, got status %d: %s", tt.allow, res.Status, res.Message)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+// accessRules maps Invoke function names to the role required to call them.
+// Roles are derived from the caller's identity by the role mapping table.
+// Functions without an entry are open to every client.
+var accessRules = map[string]string{
+	"delete":          "admin",
+	"setRoleMappings": "admin",
+}
+
+// checkAccess returns an error unless the creator of the transaction may call
+// function, either by having the required role itself or through an active
+// delegation from someone who still does.
+func checkAccess(stub shim.ChaincodeStubInterface, function string) error {
+	role, ok := accessRules[function]
+	if !ok {
+		return nil
+	}
+
+	roleErr := assertRole(stub, role)
+	if roleErr == nil {
+		return nil
+	}
+
+	id, err := cid.GetID(stub)
+	if err != nil {
+		return err
+	}
+	now, err := txTime(stub)
+	if err != nil {
+		return err
+	}
+	d, err := getDelegation(stub, function, id)
+	if err != nil {
+		return err
+	}
+	if d != nil && d.activeAt(now) {
+		// The delegator may have lost the role since delegating, for
+		// instance through setRoleMappings.
+		if err := assertRole(creatorStub{stub, d.DelegatorCreator}, role); err != nil {
+			return fmt.Errorf("access denied for %s: delegator no longer has role %s", function, role)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("access denied for %s: %s", function, roleErr)
+}
+
+// creatorStub presents a stored serialized identity as the transaction
+// creator, so the roles of an identity other than the caller can be derived.
+type creatorStub struct {
+	shim.ChaincodeStubInterface
+	creator []byte
+}
+
+func (s creatorStub) GetCreator() ([]byte, error) {
+	if s.creator == nil {
+		return nil, fmt.Errorf("identity is not known")
+	}
+	return s.creator, nil
+}
+
+// txTime returns the transaction timestamp, which unlike the local clock is
+// the same on every endorsing peer.
+func txTime(stub shim.ChaincodeStubInterface) (time.Time, error) {
+	ts, err := stub.GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(ts.GetSeconds(), int64(ts.GetNanos())).UTC(), nil
+}
@@ -0,0 +1,122 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/hyperledger/fabric-chaincode-go/pkg/attrmgr"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+	"github.com/hyperledger/fabric-protos-go/msp"
+)
+
+// testCA is an in-memory certificate authority used to issue client
+// certificates for tests, so no PEM fixtures need to be checked in.
+type testCA struct {
+	key    *ecdsa.PrivateKey
+	cert   *x509.Certificate
+	serial int64
+}
+
+// testIdentity describes the client certificate a test wants to present.
+type testIdentity struct {
+	MSPID      string
+	CommonName string
+	OUs        []string
+	Attrs      map[string]string
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate CA key: %s", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ca.example.com", Organization: []string{"Hyperledger"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create CA certificate: %s", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse CA certificate: %s", err)
+	}
+
+	return &testCA{key: key, cert: cert, serial: 1}
+}
+
+// issue returns a PEM encoded certificate for id signed by the CA. Attributes
+// are embedded using the same extension the Fabric CA uses.
+func (ca *testCA) issue(t *testing.T, id testIdentity) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate client key: %s", err)
+	}
+
+	ca.serial++
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(ca.serial),
+		Subject: pkix.Name{
+			CommonName:         id.CommonName,
+			Organization:       []string{"Hyperledger"},
+			OrganizationalUnit: id.OUs,
+		},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}
+
+	if id.Attrs != nil {
+		buf, err := json.Marshal(&attrmgr.Attributes{Attrs: id.Attrs})
+		if err != nil {
+			t.Fatalf("failed to marshal attributes: %s", err)
+		}
+		template.ExtraExtensions = append(template.ExtraExtensions, pkix.Extension{Id: attrmgr.AttrOID, Value: buf})
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("failed to create client certificate: %s", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+// serialize returns id as a marshaled msp.SerializedIdentity, which is the
+// form the peer hands to chaincode as the transaction creator.
+func (ca *testCA) serialize(t *testing.T, id testIdentity) []byte {
+	sid := &msp.SerializedIdentity{Mspid: id.MSPID, IdBytes: ca.issue(t, id)}
+	b, err := proto.Marshal(sid)
+	if err != nil {
+		t.Fatalf("failed to marshal serialized identity: %s", err)
+	}
+	return b
+}
+
+// setIdentity makes id the creator of subsequent mock transactions on stub.
+func (ca *testCA) setIdentity(t *testing.T, stub *shimtest.MockStub, id testIdentity) {
+	stub.Creator = ca.serialize(t, id)
+}
@@ -0,0 +1,185 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+)
+
+const delegationIndex = "delegation~function~delegate"
+
+// delegation grants Delegate the right to call Function until Expires, on
+// behalf of Delegator who has the role the function requires. The serialized
+// identity of the delegator is kept so its roles can be checked again each
+// time the delegation is used.
+type delegation struct {
+	Function         string    `json:"function"`
+	Delegator        string    `json:"delegator"`
+	DelegatorCreator []byte    `json:"delegatorCreator,omitempty"`
+	Delegate         string    `json:"delegate"`
+	Expires          time.Time `json:"expires"`
+}
+
+func (d *delegation) activeAt(t time.Time) bool {
+	return t.Before(d.Expires)
+}
+
+func getDelegation(stub shim.ChaincodeStubInterface, function, delegate string) (*delegation, error) {
+	key, err := stub.CreateCompositeKey(delegationIndex, []string{function, delegate})
+	if err != nil {
+		return nil, err
+	}
+	b, err := stub.GetState(key)
+	if err != nil || b == nil {
+		return nil, err
+	}
+	d := &delegation{}
+	if err := json.Unmarshal(b, d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// delegate lets a caller with the role required by a function grant another
+// identity the right to call it for a limited time.
+// args: delegateID, function, duration (e.g. "48h")
+func (t *SimpleChaincode) delegate(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 3")
+	}
+
+	delegate, function := args[0], args[1]
+	role, ok := accessRules[function]
+	if !ok {
+		return shim.Error("Function " + function + " does not require delegation")
+	}
+	duration, err := time.ParseDuration(args[2])
+	if err != nil || duration <= 0 {
+		return shim.Error("Expecting a positive duration such as \"48h\"")
+	}
+
+	// Only identities having the role themselves may delegate, so a
+	// delegation cannot be passed on by its delegate.
+	if err := assertRole(stub, role); err != nil {
+		return shim.Error(err.Error())
+	}
+	delegator, err := cid.GetID(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	creator, err := stub.GetCreator()
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	now, err := txTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	d := &delegation{
+		Function:         function,
+		Delegator:        delegator,
+		DelegatorCreator: creator,
+		Delegate:         delegate,
+		Expires:          now.Add(duration),
+	}
+	b, err := json.Marshal(d)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	key, err := stub.CreateCompositeKey(delegationIndex, []string{function, delegate})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := stub.PutState(key, b); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(b)
+}
+
+// revokeDelegation removes a delegation before it expires. Any identity with
+// the role required by the function may revoke it.
+// args: delegateID, function
+func (t *SimpleChaincode) revokeDelegation(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	delegate, function := args[0], args[1]
+	role, ok := accessRules[function]
+	if !ok {
+		return shim.Error("Function " + function + " does not require delegation")
+	}
+	if err := assertRole(stub, role); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	d, err := getDelegation(stub, function, delegate)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if d == nil {
+		return shim.Error("Delegation not found")
+	}
+
+	key, err := stub.CreateCompositeKey(delegationIndex, []string{function, delegate})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := stub.DelState(key); err != nil {
+		return shim.Error("Failed to delete state")
+	}
+
+	return shim.Success(nil)
+}
+
+// listDelegations returns the delegations that are still active at the time
+// of the transaction, optionally restricted to one function.
+// args: [function]
+func (t *SimpleChaincode) listDelegations(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) > 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 0 or 1")
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	it, err := stub.GetStateByPartialCompositeKey(delegationIndex, args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer it.Close()
+
+	delegations := []delegation{}
+	for it.HasNext() {
+		kv, err := it.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		var d delegation
+		if err := json.Unmarshal(kv.Value, &d); err != nil {
+			return shim.Error(err.Error())
+		}
+		if d.activeAt(now) {
+			delegations = append(delegations, d)
+		}
+	}
+
+	b, err := json.Marshal(delegations)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(b)
+}
@@ -0,0 +1,182 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+)
+
+var deputyIdentity = testIdentity{
+	MSPID:      "org1MSP",
+	CommonName: "deputy-org1",
+	OUs:        []string{"client"},
+	Attrs:      map[string]string{"hf.EnrollmentID": "deputy-org1"},
+}
+
+func identityID(t *testing.T, stub *shimtest.MockStub) string {
+	id, err := cid.GetID(stub)
+	if err != nil {
+		t.Fatalf("failed to get client identity: %s", err)
+	}
+	return id
+}
+
+func invokeTx(stub *shimtest.MockStub, txID string, args ...string) (int32, []byte, string) {
+	var a [][]byte
+	for _, arg := range args {
+		a = append(a, []byte(arg))
+	}
+	res := stub.MockInvoke(txID, a)
+	return res.Status, res.Payload, res.Message
+}
+
+func invokeStatus(stub *shimtest.MockStub, args ...string) (int32, []byte, string) {
+	return invokeTx(stub, "1", args...)
+}
+
+func TestAbac_DeleteAccess(t *testing.T) {
+	ca := newTestCA(t)
+
+	tests := []struct {
+		name  string
+		id    testIdentity
+		allow bool
+	}{
+		{"admin", adminIdentity, true},
+		{"deputy without delegation", deputyIdentity, false},
+		{"admin false", testIdentity{MSPID: "org1MSP", CommonName: "user1", Attrs: map[string]string{"admin": "false"}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := shimtest.NewMockStub("abac", new(SimpleChaincode))
+			ca.setIdentity(t, stub, adminIdentity)
+			checkInit(t, stub, [][]byte{[]byte("init"), []byte("A"), []byte("1"), []byte("B"), []byte("2")})
+
+			ca.setIdentity(t, stub, tt.id)
+			status, _, msg := invokeStatus(stub, "delete", "A")
+			if allowed := status == shim.OK; allowed != tt.allow {
+				t.Fatalf("expected allow=%t, got status %d: %s", tt.allow, status, msg)
+			}
+		})
+	}
+}
+
+func TestAbac_Delegation(t *testing.T) {
+	ca := newTestCA(t)
+	stub := shimtest.NewMockStub("abac", new(SimpleChaincode))
+	ca.setIdentity(t, stub, adminIdentity)
+	checkInit(t, stub, [][]byte{[]byte("init"), []byte("A"), []byte("1"), []byte("B"), []byte("2")})
+
+	ca.setIdentity(t, stub, deputyIdentity)
+	deputy := identityID(t, stub)
+
+	// The deputy may not grant itself access.
+	if status, _, _ := invokeStatus(stub, "delegate", deputy, "delete", "48h"); status == shim.OK {
+		t.Fatal("expected delegate by deputy to fail")
+	}
+
+	ca.setIdentity(t, stub, adminIdentity)
+	if status, _, msg := invokeStatus(stub, "delegate", deputy, "delete", "48h"); status != shim.OK {
+		t.Fatalf("delegate failed: %s", msg)
+	}
+	if status, _, _ := invokeStatus(stub, "delegate", deputy, "query", "48h"); status == shim.OK {
+		t.Fatal("expected delegation of unrestricted function to fail")
+	}
+	if status, _, _ := invokeStatus(stub, "delegate", deputy, "delete", "-1h"); status == shim.OK {
+		t.Fatal("expected negative duration to fail")
+	}
+
+	status, payload, msg := invokeStatus(stub, "listDelegations", "delete")
+	if status != shim.OK {
+		t.Fatalf("listDelegations failed: %s", msg)
+	}
+	var delegations []delegation
+	if err := json.Unmarshal(payload, &delegations); err != nil {
+		t.Fatalf("failed to unmarshal delegations: %s", err)
+	}
+	if len(delegations) != 1 || delegations[0].Delegate != deputy {
+		t.Fatalf("unexpected delegations: %s", payload)
+	}
+
+	// With the delegation the deputy may propose the delete.
+	ca.setIdentity(t, stub, deputyIdentity)
+	if status, _, msg := invokeStatus(stub, "delete", "A"); status != shim.OK {
+		t.Fatalf("delete by deputy failed: %s", msg)
+	}
+
+	ca.setIdentity(t, stub, adminIdentity)
+	if status, _, msg := invokeStatus(stub, "revokeDelegation", deputy, "delete"); status != shim.OK {
+		t.Fatalf("revokeDelegation failed: %s", msg)
+	}
+
+	ca.setIdentity(t, stub, deputyIdentity)
+	if status, _, _ := invokeStatus(stub, "delete", "B"); status == shim.OK {
+		t.Fatal("expected delete after revocation to fail")
+	}
+}
+
+func TestAbac_DelegationExpiry(t *testing.T) {
+	ca := newTestCA(t)
+	stub := shimtest.NewMockStub("abac", new(SimpleChaincode))
+	ca.setIdentity(t, stub, adminIdentity)
+	checkInit(t, stub, [][]byte{[]byte("init"), []byte("A"), []byte("1"), []byte("B"), []byte("2")})
+
+	ca.setIdentity(t, stub, deputyIdentity)
+	deputy := identityID(t, stub)
+
+	// Store a delegation that expired an hour ago.
+	b, _ := json.Marshal(&delegation{
+		Function: "delete",
+		Delegate: deputy,
+		Expires:  time.Now().Add(-time.Hour),
+	})
+	stub.MockTransactionStart("setup")
+	key, _ := stub.CreateCompositeKey(delegationIndex, []string{"delete", deputy})
+	if err := stub.PutState(key, b); err != nil {
+		t.Fatalf("failed to store delegation: %s", err)
+	}
+	stub.MockTransactionEnd("setup")
+
+	if status, _, _ := invokeStatus(stub, "delete", "A"); status == shim.OK {
+		t.Fatal("expected delete with expired delegation to fail")
+	}
+
+	status, payload, _ := invokeStatus(stub, "listDelegations")
+	if status != shim.OK || string(payload) != "[]" {
+		t.Fatalf("expected no active delegations, got %s", payload)
+	}
+}
+
+func TestAbac_DelegationRoleRevoked(t *testing.T) {
+	ca := newTestCA(t)
+	stub := shimtest.NewMockStub("abac", new(SimpleChaincode))
+	ca.setIdentity(t, stub, adminIdentity)
+	checkInit(t, stub, [][]byte{[]byte("init"), []byte("A"), []byte("1"), []byte("B"), []byte("2")})
+
+	ca.setIdentity(t, stub, deputyIdentity)
+	deputy := identityID(t, stub)
+
+	ca.setIdentity(t, stub, adminIdentity)
+	if status, _, msg := invokeStatus(stub, "delegate", deputy, "delete", "48h"); status != shim.OK {
+		t.Fatalf("delegate failed: %s", msg)
+	}
+
+	// The delegator loses the admin role, which the delegation relied on.
+	setRoleMappings(t, ca, stub, `[{"role":"admin","mspid":"org2MSP","ou":"fleet"},{"role":"approver","mspid":"org1MSP","attribute":"abac.approver","value":"true"}]`)
+
+	ca.setIdentity(t, stub, deputyIdentity)
+	if status, _, _ := invokeStatus(stub, "delete", "A"); status == shim.OK {
+		t.Fatal("expected delete through the delegation of a former admin to fail")
+	}
+}
@@ -0,0 +1,249 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+)
+
+const proposalIndex = "proposal~id"
+
+// Proposal states
+const (
+	proposalPending  = "pending"
+	proposalExecuted = "executed"
+)
+
+// privilegedRule describes the approvals a privileged function needs before
+// it is executed.
+type privilegedRule struct {
+	Approvals int           // number of distinct approvers required
+	Approver  string        // role every approver must have
+	Window    time.Duration // time allowed to collect the approvals
+
+	// Check, if set, rejects malformed arguments when the proposal is made
+	// rather than when it is executed
+	Check func(args []string) error
+}
+
+// privilegedFunctions maps Invoke function names that are never executed
+// directly. Calling one of them creates a proposal instead.
+var privilegedFunctions = map[string]privilegedRule{
+	"delete": {
+		Approvals: 2,
+		Approver:  "approver",
+		Window:    24 * time.Hour,
+	},
+	"setRoleMappings": {
+		Approvals: 2,
+		Approver:  "approver",
+		Window:    24 * time.Hour,
+		Check: func(args []string) error {
+			_, err := parseRoleMappings(args)
+			return err
+		},
+	},
+}
+
+// proposal is a pending call to a privileged function.
+type proposal struct {
+	ID        string    `json:"id"`
+	Function  string    `json:"function"`
+	Args      []string  `json:"args"`
+	Proposer  string    `json:"proposer"`
+	Approvers []string  `json:"approvers"`
+	Deadline  time.Time `json:"deadline"`
+	Status    string    `json:"status"`
+}
+
+func loadProposal(stub shim.ChaincodeStubInterface, id string) (*proposal, error) {
+	key, err := stub.CreateCompositeKey(proposalIndex, []string{id})
+	if err != nil {
+		return nil, err
+	}
+	b, err := stub.GetState(key)
+	if err != nil || b == nil {
+		return nil, err
+	}
+	p := &proposal{}
+	if err := json.Unmarshal(b, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func storeProposal(stub shim.ChaincodeStubInterface, p *proposal) ([]byte, error) {
+	key, err := stub.CreateCompositeKey(proposalIndex, []string{p.ID})
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	return b, stub.PutState(key, b)
+}
+
+// propose records a call to a privileged function as a pending proposal,
+// identified by the transaction ID.
+func (t *SimpleChaincode) propose(stub shim.ChaincodeStubInterface, function string, args []string, rule privilegedRule) pb.Response {
+	if rule.Check != nil {
+		if err := rule.Check(args); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	proposer, err := cid.GetID(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	now, err := txTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	p := &proposal{
+		ID:        stub.GetTxID(),
+		Function:  function,
+		Args:      args,
+		Proposer:  proposer,
+		Approvers: []string{},
+		Deadline:  now.Add(rule.Window),
+		Status:    proposalPending,
+	}
+	b, err := storeProposal(stub, p)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(b)
+}
+
+// approve adds the caller's approval to a pending proposal.
+// args: proposalID
+func (t *SimpleChaincode) approve(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	p, err := loadProposal(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if p == nil {
+		return shim.Error("Proposal not found")
+	}
+	if p.Status != proposalPending {
+		return shim.Error("Proposal is " + p.Status)
+	}
+	now, err := txTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !now.Before(p.Deadline) {
+		return shim.Error("Proposal deadline has passed")
+	}
+
+	rule := privilegedFunctions[p.Function]
+	if err := assertRole(stub, rule.Approver); err != nil {
+		return shim.Error(err.Error())
+	}
+	approver, err := cid.GetID(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	for _, a := range p.Approvers {
+		if a == approver {
+			return shim.Error("Proposal already approved by this identity")
+		}
+	}
+
+	p.Approvers = append(p.Approvers, approver)
+	b, err := storeProposal(stub, p)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(b)
+}
+
+// execute runs a proposal once it has collected enough approvals before its
+// deadline.
+// args: proposalID
+func (t *SimpleChaincode) execute(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	p, err := loadProposal(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if p == nil {
+		return shim.Error("Proposal not found")
+	}
+	if p.Status != proposalPending {
+		return shim.Error("Proposal is " + p.Status)
+	}
+	now, err := txTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !now.Before(p.Deadline) {
+		return shim.Error("Proposal deadline has passed")
+	}
+	rule := privilegedFunctions[p.Function]
+	if len(p.Approvers) < rule.Approvals {
+		return shim.Error("Proposal does not have enough approvals")
+	}
+
+	var res pb.Response
+	switch p.Function {
+	case "delete":
+		res = t.delete(stub, p.Args)
+	case "setRoleMappings":
+		res = t.setRoleMappings(stub, p.Args)
+	default:
+		return shim.Error("Unknown privileged function " + p.Function)
+	}
+	if res.Status != shim.OK {
+		return res
+	}
+
+	p.Status = proposalExecuted
+	if _, err := storeProposal(stub, p); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return res
+}
+
+// getProposal returns a proposal by ID.
+// args: proposalID
+func (t *SimpleChaincode) getProposal(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	key, err := stub.CreateCompositeKey(proposalIndex, []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	b, err := stub.GetState(key)
+	if err != nil {
+		return shim.Error("Failed to get state")
+	}
+	if b == nil {
+		return shim.Error("Proposal not found")
+	}
+
+	return shim.Success(b)
+}
@@ -0,0 +1,139 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+)
+
+func approverIdentity(name string) testIdentity {
+	return testIdentity{
+		MSPID:      "org1MSP",
+		CommonName: name,
+		OUs:        []string{"client"},
+		Attrs:      map[string]string{"abac.approver": "true"},
+	}
+}
+
+func proposeDelete(t *testing.T, ca *testCA, stub *shimtest.MockStub, txID, name string) *proposal {
+	ca.setIdentity(t, stub, adminIdentity)
+	status, payload, msg := invokeTx(stub, txID, "delete", name)
+	if status != shim.OK {
+		t.Fatalf("delete proposal failed: %s", msg)
+	}
+	p := &proposal{}
+	if err := json.Unmarshal(payload, p); err != nil {
+		t.Fatalf("failed to unmarshal proposal: %s", err)
+	}
+	return p
+}
+
+func TestAbac_ProposalExecute(t *testing.T) {
+	ca := newTestCA(t)
+	stub := shimtest.NewMockStub("abac", new(SimpleChaincode))
+	ca.setIdentity(t, stub, adminIdentity)
+	checkInit(t, stub, [][]byte{[]byte("init"), []byte("A"), []byte("1"), []byte("B"), []byte("2")})
+
+	p := proposeDelete(t, ca, stub, "tx1", "A")
+	if p.ID != "tx1" || p.Status != proposalPending {
+		t.Fatalf("unexpected proposal: %+v", p)
+	}
+	checkState(t, stub, "A", "1")
+
+	if status, _, _ := invokeTx(stub, "tx2", "execute", p.ID); status == shim.OK {
+		t.Fatal("expected execute without approvals to fail")
+	}
+
+	// The admin does not hold the approver attribute.
+	if status, _, _ := invokeTx(stub, "tx3", "approve", p.ID); status == shim.OK {
+		t.Fatal("expected approve by non-approver to fail")
+	}
+
+	ca.setIdentity(t, stub, approverIdentity("approver1"))
+	if status, _, msg := invokeTx(stub, "tx4", "approve", p.ID); status != shim.OK {
+		t.Fatalf("approve failed: %s", msg)
+	}
+	if status, _, _ := invokeTx(stub, "tx5", "approve", p.ID); status == shim.OK {
+		t.Fatal("expected duplicate approval to fail")
+	}
+	if status, _, _ := invokeTx(stub, "tx6", "execute", p.ID); status == shim.OK {
+		t.Fatal("expected execute with one approval to fail")
+	}
+
+	ca.setIdentity(t, stub, approverIdentity("approver2"))
+	if status, _, msg := invokeTx(stub, "tx7", "approve", p.ID); status != shim.OK {
+		t.Fatalf("approve failed: %s", msg)
+	}
+	if status, _, msg := invokeTx(stub, "tx8", "execute", p.ID); status != shim.OK {
+		t.Fatalf("execute failed: %s", msg)
+	}
+	if stub.State["A"] != nil {
+		t.Fatal("expected A to be deleted")
+	}
+	checkState(t, stub, "B", "2")
+
+	if status, _, _ := invokeTx(stub, "tx9", "execute", p.ID); status == shim.OK {
+		t.Fatal("expected second execute to fail")
+	}
+
+	status, payload, msg := invokeTx(stub, "tx10", "getProposal", p.ID)
+	if status != shim.OK {
+		t.Fatalf("getProposal failed: %s", msg)
+	}
+	got := &proposal{}
+	if err := json.Unmarshal(payload, got); err != nil {
+		t.Fatalf("failed to unmarshal proposal: %s", err)
+	}
+	if got.Status != proposalExecuted || len(got.Approvers) != 2 {
+		t.Fatalf("unexpected proposal: %s", payload)
+	}
+}
+
+func TestAbac_ProposalDeadline(t *testing.T) {
+	ca := newTestCA(t)
+	stub := shimtest.NewMockStub("abac", new(SimpleChaincode))
+	ca.setIdentity(t, stub, adminIdentity)
+	checkInit(t, stub, [][]byte{[]byte("init"), []byte("A"), []byte("1"), []byte("B"), []byte("2")})
+
+	p := proposeDelete(t, ca, stub, "tx1", "A")
+
+	for _, name := range []string{"approver1", "approver2"} {
+		ca.setIdentity(t, stub, approverIdentity(name))
+		if status, _, msg := invokeTx(stub, "approve-"+name, "approve", p.ID); status != shim.OK {
+			t.Fatalf("approve failed: %s", msg)
+		}
+	}
+
+	// Move the deadline into the past.
+	p = loadProposalFromState(t, stub, p.ID)
+	p.Deadline = time.Now().Add(-time.Minute)
+	stub.MockTransactionStart("setup")
+	if _, err := storeProposal(stub, p); err != nil {
+		t.Fatalf("failed to store proposal: %s", err)
+	}
+	stub.MockTransactionEnd("setup")
+
+	if status, _, _ := invokeTx(stub, "tx2", "execute", p.ID); status == shim.OK {
+		t.Fatal("expected execute after deadline to fail")
+	}
+	checkState(t, stub, "A", "1")
+}
+
+func loadProposalFromState(t *testing.T, stub *shimtest.MockStub, id string) *proposal {
+	stub.MockTransactionStart("load")
+	defer stub.MockTransactionEnd("load")
+	p, err := loadProposal(stub, id)
+	if err != nil || p == nil {
+		t.Fatalf("failed to load proposal %s: %v", id, err)
+	}
+	return p
+}
@@ -0,0 +1,291 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// roleMapping grants Role to every client matching all of its non-empty
+// criteria: the MSP ID, an OU in the certificate subject, and an attribute
+// with the given value.
+type roleMapping struct {
+	Role      string `json:"role"`
+	MSPID     string `json:"mspid,omitempty"`
+	OU        string `json:"ou,omitempty"`
+	Attribute string `json:"attribute,omitempty"`
+	Value     string `json:"value,omitempty"`
+}
+
+// initializerMapping grants the initializer role, the only role there is
+// until the chaincode has been initialized and has an owning MSP.
+var initializerMapping = roleMapping{Role: "initializer", Attribute: "abac.init", Value: "true"}
+
+// defaultRoleMappings apply until setRoleMappings stores a table on the
+// ledger. Every mapping is pinned to the owning MSP, so the CA of another
+// member org cannot issue identities that get these roles.
+func defaultRoleMappings(ownerMSP string) []roleMapping {
+	mappings := []roleMapping{
+		{Role: "admin", Attribute: "admin", Value: "true"},
+		{Role: "admin", OU: "admin"},
+		{Role: "approver", Attribute: "abac.approver", Value: "true"},
+		{Role: "client", OU: "client"},
+		{Role: "peer", OU: "peer"},
+		initializerMapping,
+	}
+	for i := range mappings {
+		mappings[i].MSPID = ownerMSP
+	}
+	return mappings
+}
+
+func roleMappingsKey(stub shim.ChaincodeStubInterface) (string, error) {
+	return stub.CreateCompositeKey("config", []string{"roleMappings"})
+}
+
+func ownerMSPKey(stub shim.ChaincodeStubInterface) (string, error) {
+	return stub.CreateCompositeKey("config", []string{"ownerMSP"})
+}
+
+// getOwnerMSP returns the MSP ID of the org that initialized the chaincode,
+// or "" before it has been initialized.
+func getOwnerMSP(stub shim.ChaincodeStubInterface) (string, error) {
+	key, err := ownerMSPKey(stub)
+	if err != nil {
+		return "", err
+	}
+	b, err := stub.GetState(key)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// claimOwnerMSP makes the MSP of the transaction creator the owning MSP,
+// unless the chaincode already has one.
+func claimOwnerMSP(stub shim.ChaincodeStubInterface) error {
+	owner, err := getOwnerMSP(stub)
+	if err != nil || owner != "" {
+		return err
+	}
+	mspID, err := cid.GetMSPID(stub)
+	if err != nil {
+		return err
+	}
+	key, err := ownerMSPKey(stub)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(key, []byte(mspID))
+}
+
+func getRoleMappings(stub shim.ChaincodeStubInterface) ([]roleMapping, error) {
+	key, err := roleMappingsKey(stub)
+	if err != nil {
+		return nil, err
+	}
+	b, err := stub.GetState(key)
+	if err != nil {
+		return nil, err
+	}
+	if b == nil {
+		owner, err := getOwnerMSP(stub)
+		if err != nil {
+			return nil, err
+		}
+		if owner == "" {
+			return []roleMapping{initializerMapping}, nil
+		}
+		return defaultRoleMappings(owner), nil
+	}
+	var mappings []roleMapping
+	if err := json.Unmarshal(b, &mappings); err != nil {
+		return nil, err
+	}
+	return mappings, nil
+}
+
+// matches reports whether the client identity satisfies every criterion of
+// the mapping.
+func (m *roleMapping) matches(id cid.ClientIdentity) (bool, error) {
+	if m.MSPID != "" {
+		mspID, err := id.GetMSPID()
+		if err != nil {
+			return false, err
+		}
+		if mspID != m.MSPID {
+			return false, nil
+		}
+	}
+	if m.OU != "" {
+		cert, err := id.GetX509Certificate()
+		if err != nil {
+			return false, err
+		}
+		if cert == nil {
+			return false, nil
+		}
+		found := false
+		for _, ou := range cert.Subject.OrganizationalUnit {
+			if ou == m.OU {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false, nil
+		}
+	}
+	if m.Attribute != "" {
+		value, found, err := id.GetAttributeValue(m.Attribute)
+		if err != nil {
+			return false, err
+		}
+		if !found || value != m.Value {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// getRoles derives the roles of the transaction creator from the role
+// mapping table.
+func getRoles(stub shim.ChaincodeStubInterface) ([]string, error) {
+	mappings, err := getRoleMappings(stub)
+	if err != nil {
+		return nil, err
+	}
+	id, err := cid.New(stub)
+	if err != nil {
+		return nil, err
+	}
+
+	roles := []string{}
+	seen := map[string]bool{}
+	for _, m := range mappings {
+		if seen[m.Role] {
+			continue
+		}
+		ok, err := m.matches(id)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			seen[m.Role] = true
+			roles = append(roles, m.Role)
+		}
+	}
+	return roles, nil
+}
+
+// assertRole returns an error unless the transaction creator has role.
+func assertRole(stub shim.ChaincodeStubInterface, role string) error {
+	roles, err := getRoles(stub)
+	if err != nil {
+		return err
+	}
+	for _, r := range roles {
+		if r == role {
+			return nil
+		}
+	}
+	return errors.New("client does not have role " + role)
+}
+
+// parseRoleMappings decodes a role mapping table. A table must keep at least
+// one mapping granting "admin", or no one could ever change it again.
+func parseRoleMappings(args []string) ([]roleMapping, error) {
+	if len(args) != 1 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 1")
+	}
+
+	var mappings []roleMapping
+	if err := json.Unmarshal([]byte(args[0]), &mappings); err != nil {
+		return nil, errors.New("Expecting a JSON array of role mappings: " + err.Error())
+	}
+	hasAdmin := false
+	for _, m := range mappings {
+		if m.Role == "" {
+			return nil, errors.New("Role mapping is missing a role")
+		}
+		if m.MSPID == "" && m.OU == "" && m.Attribute == "" {
+			return nil, errors.New("Role mapping for " + m.Role + " has no criteria")
+		}
+		if m.Role == "admin" {
+			hasAdmin = true
+		}
+	}
+	if !hasAdmin {
+		return nil, errors.New("Role mappings must grant the admin role")
+	}
+	return mappings, nil
+}
+
+// setRoleMappings replaces the role mapping table. It is a privileged
+// function, so it only runs once a proposal for it has been approved.
+// args: JSON array of {role, mspid, ou, attribute, value}
+func (t *SimpleChaincode) setRoleMappings(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	mappings, err := parseRoleMappings(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	b, err := json.Marshal(mappings)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	key, err := roleMappingsKey(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := stub.PutState(key, b); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// getRoleMappings returns the role mapping table in effect.
+func (t *SimpleChaincode) getRoleMappings(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 0 {
+		return shim.Error("Incorrect number of arguments. Expecting 0")
+	}
+
+	mappings, err := getRoleMappings(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	b, err := json.Marshal(mappings)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(b)
+}
+
+// getRoles returns the roles of the caller.
+func (t *SimpleChaincode) getRoles(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 0 {
+		return shim.Error("Incorrect number of arguments. Expecting 0")
+	}
+
+	roles, err := getRoles(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	b, err := json.Marshal(roles)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(b)
+}
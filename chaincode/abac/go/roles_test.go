@@ -0,0 +1,155 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+)
+
+func TestAbac_DefaultRoles(t *testing.T) {
+	ca := newTestCA(t)
+
+	tests := []struct {
+		name  string
+		id    testIdentity
+		roles []string
+	}{
+		{"admin attribute", adminIdentity, []string{"admin", "client", "initializer"}},
+		{"admin OU", testIdentity{MSPID: "org1MSP", CommonName: "Admin@org1", OUs: []string{"admin"}}, []string{"admin"}},
+		{"peer OU", testIdentity{MSPID: "org1MSP", CommonName: "peer0", OUs: []string{"peer"}}, []string{"peer"}},
+		{"approver", approverIdentity("approver1"), []string{"approver", "client"}},
+		{"nothing", testIdentity{MSPID: "org1MSP", CommonName: "nobody"}, []string{}},
+		// The defaults only grant roles to members of the owning MSP, org1MSP.
+		{"other org admin OU", testIdentity{MSPID: "org2MSP", CommonName: "Admin@org2", OUs: []string{"admin"}}, []string{}},
+		{"other org attributes", testIdentity{MSPID: "org2MSP", CommonName: "user2", OUs: []string{"client"}, Attrs: map[string]string{"admin": "true", "abac.approver": "true", "abac.init": "true"}}, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := shimtest.NewMockStub("abac", new(SimpleChaincode))
+			ca.setIdentity(t, stub, adminIdentity)
+			checkInit(t, stub, [][]byte{[]byte("init"), []byte("A"), []byte("1"), []byte("B"), []byte("2")})
+			ca.setIdentity(t, stub, tt.id)
+
+			status, payload, msg := invokeStatus(stub, "getRoles")
+			if status != shim.OK {
+				t.Fatalf("getRoles failed: %s", msg)
+			}
+			var roles []string
+			if err := json.Unmarshal(payload, &roles); err != nil {
+				t.Fatalf("failed to unmarshal roles: %s", err)
+			}
+			if !reflect.DeepEqual(roles, tt.roles) {
+				t.Fatalf("expected roles %v, got %v", tt.roles, roles)
+			}
+		})
+	}
+}
+
+func TestAbac_RolesBeforeInit(t *testing.T) {
+	ca := newTestCA(t)
+	stub := shimtest.NewMockStub("abac", new(SimpleChaincode))
+
+	// Until the chaincode has an owning MSP only the initializer role exists.
+	ca.setIdentity(t, stub, adminIdentity)
+	status, payload, msg := invokeStatus(stub, "getRoles")
+	if status != shim.OK || string(payload) != `["initializer"]` {
+		t.Fatalf("unexpected roles before init: %s %s", payload, msg)
+	}
+
+	checkInit(t, stub, [][]byte{[]byte("init"), []byte("A"), []byte("1"), []byte("B"), []byte("2")})
+
+	// Initializing again, as on upgrade, is limited to the owning MSP.
+	ca.setIdentity(t, stub, testIdentity{MSPID: "org2MSP", CommonName: "admin-org2", Attrs: map[string]string{"abac.init": "true"}})
+	res := stub.MockInit("2", [][]byte{[]byte("init"), []byte("A"), []byte("1"), []byte("B"), []byte("2")})
+	if res.Status == shim.OK {
+		t.Fatal("expected init by another org to fail")
+	}
+	ca.setIdentity(t, stub, adminIdentity)
+	checkInit(t, stub, [][]byte{[]byte("init"), []byte("A"), []byte("1"), []byte("B"), []byte("2")})
+}
+
+func TestAbac_SetRoleMappings(t *testing.T) {
+	ca := newTestCA(t)
+	stub := shimtest.NewMockStub("abac", new(SimpleChaincode))
+	ca.setIdentity(t, stub, adminIdentity)
+	checkInit(t, stub, [][]byte{[]byte("init"), []byte("A"), []byte("1"), []byte("B"), []byte("2")})
+
+	manager := testIdentity{MSPID: "org2MSP", CommonName: "manager", OUs: []string{"client", "fleet"}}
+	mappings := `[{"role":"admin","mspid":"org2MSP","ou":"fleet"},{"role":"approver","attribute":"abac.approver","value":"true"}]`
+
+	ca.setIdentity(t, stub, manager)
+	if status, _, _ := invokeStatus(stub, "delete", "A"); status == shim.OK {
+		t.Fatal("expected delete by manager to fail before mapping")
+	}
+	if status, _, _ := invokeStatus(stub, "setRoleMappings", mappings); status == shim.OK {
+		t.Fatal("expected setRoleMappings by non-admin to fail")
+	}
+
+	ca.setIdentity(t, stub, adminIdentity)
+	for _, invalid := range []string{`[{"role":"admin"}]`, `{}`, `[]`, `null`, `[{"role":"approver","ou":"fleet"}]`} {
+		if status, _, _ := invokeStatus(stub, "setRoleMappings", invalid); status == shim.OK {
+			t.Fatalf("expected mappings %s to be rejected", invalid)
+		}
+	}
+	setRoleMappings(t, ca, stub, mappings)
+
+	status, payload, _ := invokeStatus(stub, "getRoleMappings")
+	if status != shim.OK || string(payload) != mappings {
+		t.Fatalf("unexpected role mappings: %s", payload)
+	}
+
+	// The admin attribute no longer grants the admin role.
+	if status, _, _ := invokeStatus(stub, "delete", "A"); status == shim.OK {
+		t.Fatal("expected delete by former admin to fail")
+	}
+
+	ca.setIdentity(t, stub, manager)
+	if status, _, msg := invokeStatus(stub, "delete", "A"); status != shim.OK {
+		t.Fatalf("delete by manager failed: %s", msg)
+	}
+
+	// The fleet OU only maps to admin for org2.
+	ca.setIdentity(t, stub, testIdentity{MSPID: "org1MSP", CommonName: "other", OUs: []string{"fleet"}})
+	if status, _, _ := invokeStatus(stub, "delete", "A"); status == shim.OK {
+		t.Fatal("expected delete by org1 fleet member to fail")
+	}
+}
+
+// setRoleMappings proposes a role mapping table as the admin and has two
+// approvers approve and execute it.
+func setRoleMappings(t *testing.T, ca *testCA, stub *shimtest.MockStub, mappings string) {
+	ca.setIdentity(t, stub, adminIdentity)
+	status, payload, msg := invokeTx(stub, "propose-mappings", "setRoleMappings", mappings)
+	if status != shim.OK {
+		t.Fatalf("setRoleMappings proposal failed: %s", msg)
+	}
+	p := &proposal{}
+	if err := json.Unmarshal(payload, p); err != nil {
+		t.Fatalf("failed to unmarshal proposal: %s", err)
+	}
+
+	// The table is not replaced until the proposal is approved
+	if status, _, _ := invokeTx(stub, "execute-mappings-early", "execute", p.ID); status == shim.OK {
+		t.Fatal("expected execute without approvals to fail")
+	}
+
+	for _, name := range []string{"approver1", "approver2"} {
+		ca.setIdentity(t, stub, approverIdentity(name))
+		if status, _, msg := invokeTx(stub, "approve-mappings-"+name, "approve", p.ID); status != shim.OK {
+			t.Fatalf("approve failed: %s", msg)
+		}
+	}
+	if status, _, msg := invokeTx(stub, "execute-mappings", "execute", p.ID); status != shim.OK {
+		t.Fatalf("execute failed: %s", msg)
+	}
+}
@@ -0,0 +1,222 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// archiveIndex is the composite key prefix for archived cars
+const archiveIndex = "archive~carNumber"
+
+// registryAdminAttribute is the certificate attribute identifying registry
+// administrators
+const registryAdminAttribute = "fabcar.admin"
+
+// ArchivedCar structure used for holding the final record of a deleted car
+type ArchivedCar struct {
+	CarNumber  string    `json:"carNumber"`
+	Record     *Car      `json:"record"`
+	ArchivedBy string    `json:"archivedBy"`
+	TxID       string    `json:"txId"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// isRegistryAdmin returns true when the submitting client is a registry admin
+func isRegistryAdmin(ctx contractapi.TransactionContextInterface) bool {
+	return ctx.GetClientIdentity().AssertAttributeValue(registryAdminAttribute, "true") == nil
+}
+
+func archiveKey(ctx contractapi.TransactionContextInterface, carNumber string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(archiveIndex, []string{carNumber})
+}
+
+// isArchived returns true when the car with given id has been deleted and is
+// held in the archive
+func (s *SmartContract) isArchived(ctx contractapi.TransactionContextInterface, carNumber string) (bool, error) {
+	key, err := archiveKey(ctx, carNumber)
+
+	if err != nil {
+		return false, err
+	}
+
+	archivedAsBytes, err := ctx.GetStub().GetState(key)
+
+	if err != nil {
+		return false, fmt.Errorf("Failed to read from world state. %s", err.Error())
+	}
+
+	return archivedAsBytes != nil, nil
+}
+
+// DeleteCar archives the car with given id and removes it from world state,
+// along with any pending transfer and its sale terms. Its VIN index entry is
+// kept, so neither the car number nor the VIN of an archived car can be
+// registered again and a deleted car cannot come back with a fresh mileage
+// and status. Only the owner or a registry admin may delete a car. Emits
+// CarDeleted
+func (s *SmartContract) DeleteCar(ctx contractapi.TransactionContextInterface, carNumber string) error {
+	car, err := s.QueryCar(ctx, carNumber)
+
+	if err != nil {
+		return err
+	}
+
+	if !isRegistryAdmin(ctx) {
+		if err := assertOwner(ctx, carNumber, car); err != nil {
+			return newError(ErrForbidden, "only the owner of %s or a registry admin may delete it", carNumber)
+		}
+	}
+
+	id, err := clientID(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	ts, err := ctx.GetStub().GetTxTimestamp()
+
+	if err != nil {
+		return fmt.Errorf("Failed to read transaction timestamp. %s", err.Error())
+	}
+
+	archived := ArchivedCar{
+		CarNumber:  carNumber,
+		Record:     car,
+		ArchivedBy: id,
+		TxID:       ctx.GetStub().GetTxID(),
+		Timestamp:  time.Unix(ts.Seconds, int64(ts.Nanos)).UTC(),
+	}
+
+	archivedAsBytes, err := json.Marshal(archived)
+
+	if err != nil {
+		return fmt.Errorf("Failed to marshal archive of %s. %s", carNumber, err.Error())
+	}
+
+	key, err := archiveKey(ctx, carNumber)
+
+	if err != nil {
+		return err
+	}
+
+	if err := ctx.GetStub().PutState(key, archivedAsBytes); err != nil {
+		return fmt.Errorf("Failed to put to world state. %s", err.Error())
+	}
+
+	if err := s.clearTransfer(ctx, carNumber); err != nil {
+		return err
+	}
+
+	if err := ctx.GetStub().DelState(carNumber); err != nil {
+		return fmt.Errorf("Failed to delete from world state. %s", err.Error())
+	}
+
+	return setEvent(ctx, EventCarDeleted, CarDeletedEvent{
+		CarNumber: carNumber,
+		TxID:      ctx.GetStub().GetTxID(),
+	})
+}
+
+// GetArchivedCar returns the archived record of the deleted car with given id
+func (s *SmartContract) GetArchivedCar(ctx contractapi.TransactionContextInterface, carNumber string) (*ArchivedCar, error) {
+	key, err := archiveKey(ctx, carNumber)
+
+	if err != nil {
+		return nil, err
+	}
+
+	archivedAsBytes, err := ctx.GetStub().GetState(key)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read from world state. %s", err.Error())
+	}
+
+	if archivedAsBytes == nil {
+		return nil, newError(ErrCarNotFound, "%s is not archived", carNumber)
+	}
+
+	archived := new(ArchivedCar)
+
+	if err := json.Unmarshal(archivedAsBytes, archived); err != nil {
+		return nil, fmt.Errorf("Failed to read archive of %s. %s", carNumber, err.Error())
+	}
+
+	if archived.Record == nil {
+		return nil, newError(ErrMalformedRecord, "the archive of %s has no car record", carNumber)
+	}
+
+	if err := archived.Record.upgrade(carNumber); err != nil {
+		return nil, err
+	}
+
+	return archived, nil
+}
+
+// RestoreCar moves the archived car with given id back into world state.
+// Only a registry admin may restore a car. Emits CarCreated
+func (s *SmartContract) RestoreCar(ctx contractapi.TransactionContextInterface, carNumber string) error {
+	if !isRegistryAdmin(ctx) {
+		return newError(ErrForbidden, "only a registry admin may restore %s", carNumber)
+	}
+
+	archived, err := s.GetArchivedCar(ctx, carNumber)
+
+	if err != nil {
+		return err
+	}
+
+	car := archived.Record
+
+	exists, err := s.carExists(ctx, carNumber)
+
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return newError(ErrCarExists, "%s already exists", carNumber)
+	}
+
+	if car.VIN != "" {
+		existing, err := s.carNumberForVIN(ctx, car.VIN)
+
+		if err != nil {
+			return err
+		}
+
+		if existing != "" && existing != carNumber {
+			return newError(ErrVINExists, "VIN %s is already registered to %s", car.VIN, existing)
+		}
+
+		if err := s.putVINIndex(ctx, car.VIN, carNumber); err != nil {
+			return err
+		}
+	}
+
+	if err := s.putCar(ctx, carNumber, car); err != nil {
+		return err
+	}
+
+	key, err := archiveKey(ctx, carNumber)
+
+	if err != nil {
+		return err
+	}
+
+	if err := ctx.GetStub().DelState(key); err != nil {
+		return err
+	}
+
+	return setEvent(ctx, EventCarCreated, CarCreatedEvent{
+		CarNumber: carNumber,
+		Car:       car,
+		TxID:      ctx.GetStub().GetTxID(),
+	})
+}
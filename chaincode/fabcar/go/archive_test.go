@@ -0,0 +1,130 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDeleteCar(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+	createCar(t, ctx, "CAR1", vin1)
+	offerCar(t, ctx, "CAR1", 0)
+
+	assertCode(t, s.DeleteCar(ctx.as(bob), "CAR1"), ErrForbidden)
+	assertNoError(t, s.DeleteCar(ctx.as(alice), "CAR1"))
+
+	_, err := s.QueryCar(ctx.as(alice), "CAR1")
+	assertCode(t, err, ErrCarNotFound)
+
+	_, err = s.QueryCarByVIN(ctx.as(alice), vin1)
+	assertCode(t, err, ErrCarNotFound)
+
+	_, err = s.QueryCarTransfer(ctx.as(alice), "CAR1")
+	assertCode(t, err, ErrTransferNotFound)
+
+	archived, err := s.GetArchivedCar(ctx.as(alice), "CAR1")
+	assertNoError(t, err)
+
+	if archived.ArchivedBy != "alice" || archived.Record.VIN != vin1 || archived.TxID == "" || archived.Timestamp.IsZero() {
+		t.Fatalf("unexpected archive %+v", archived)
+	}
+
+	assertCode(t, s.DeleteCar(ctx.as(alice), "CAR1"), ErrCarNotFound)
+}
+
+func TestDeleteCar_Admin(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+	createCar(t, ctx, "CAR1", vin1)
+
+	assertNoError(t, s.DeleteCar(ctx.as(admin), "CAR1"))
+}
+
+func TestRestoreCar(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+	createCar(t, ctx, "CAR1", vin1)
+	assertNoError(t, s.DeleteCar(ctx.as(alice), "CAR1"))
+
+	assertCode(t, s.RestoreCar(ctx.as(alice), "CAR1"), ErrForbidden)
+	assertCode(t, s.RestoreCar(ctx.as(admin), "CAR2"), ErrCarNotFound)
+	assertNoError(t, s.RestoreCar(ctx.as(admin), "CAR1"))
+
+	result, err := s.QueryCarByVIN(ctx.as(alice), vin1)
+	assertNoError(t, err)
+
+	if result.Key != "CAR1" || result.Record.OwnerID != "alice" {
+		t.Fatalf("unexpected restored car %+v", result)
+	}
+
+	_, err = s.GetArchivedCar(ctx.as(alice), "CAR1")
+	assertCode(t, err, ErrCarNotFound)
+}
+
+func TestDeleteCar_Reserved(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+	createCar(t, ctx, "CAR1", vin1)
+	assertNoError(t, s.ListForSale(ctx.as(alice), "CAR1"))
+	assertNoError(t, s.Scrap(ctx.as(alice), "CAR1"))
+	assertNoError(t, s.DeleteCar(ctx.as(alice), "CAR1"))
+
+	// A scrapped car cannot come back under a new number or on the old one
+	assertCode(t, s.CreateCar(ctx.as(alice), "CAR2", "Toyota", "Prius", "blue", "Tomoko", vin1), ErrVINExists)
+	assertCode(t, s.CreateCar(ctx.as(alice), "CAR1", "Toyota", "Prius", "blue", "Tomoko", vin2), ErrCarExists)
+
+	results, err := s.ImportCars(ctx.as(alice), []CarImport{{CarNumber: "CAR3", Make: "Toyota", Model: "Prius", Colour: "blue", Owner: "Tomoko", VIN: vin1}})
+	assertNoError(t, err)
+
+	if results[0].Imported || !strings.HasPrefix(results[0].Error, string(ErrVINExists)) {
+		t.Fatalf("expected the archived VIN to be refused, got %+v", results[0])
+	}
+}
+
+func TestRegisterCar_SkipsArchived(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+	createCar(t, ctx, "CAR00000001", vin1)
+	assertNoError(t, s.DeleteCar(ctx.as(alice), "CAR00000001"))
+
+	carNumber, err := s.RegisterCar(ctx.as(alice), "Toyota", "Prius", "blue", "Tomoko", vin2, false)
+	assertNoError(t, err)
+
+	if carNumber != "CAR00000002" {
+		t.Fatalf("expected the archived number to be skipped, got %s", carNumber)
+	}
+}
+
+func TestRestoreCar_Conflicts(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+	createCar(t, ctx, "CAR1", vin1)
+	createCar(t, ctx, "CAR2", vin2)
+	assertNoError(t, s.DeleteCar(ctx.as(alice), "CAR1"))
+	assertNoError(t, s.DeleteCar(ctx.as(alice), "CAR2"))
+
+	// Records written before archived cars were reserved
+	ctx.putRaw(t, "CAR1", legacyCar)
+	assertCode(t, s.RestoreCar(ctx.as(admin), "CAR1"), ErrCarExists)
+
+	vinIndexKey, _ := ctx.stub.CreateCompositeKey(vinIndex, []string{vin2, "CAR2"})
+	assertNoError(t, ctx.as(admin).stub.DelState(vinIndexKey))
+	createCar(t, ctx, "CAR3", vin2)
+	assertCode(t, s.RestoreCar(ctx.as(admin), "CAR2"), ErrVINExists)
+}
+
+func TestGetArchivedCar_CorruptJSON(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+	key, _ := ctx.stub.CreateCompositeKey(archiveIndex, []string{"CAR1"})
+	ctx.putRaw(t, key, "}")
+
+	if _, err := s.GetArchivedCar(ctx.as(alice), "CAR1"); err == nil {
+		t.Fatal("expected an error reading a corrupt archive")
+	}
+}
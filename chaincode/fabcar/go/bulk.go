@@ -0,0 +1,157 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// maxImportCars limits the number of cars ImportCars accepts in one
+// transaction, keeping the read-write set to a reasonable size
+const maxImportCars = 100
+
+// CarImport describes one car passed to ImportCars
+type CarImport struct {
+	CarNumber string `json:"carNumber"`
+	Make      string `json:"make"`
+	Model     string `json:"model"`
+	Colour    string `json:"colour"`
+	Owner     string `json:"owner"`
+	VIN       string `json:"vin"`
+}
+
+// ImportResult structure used for reporting the outcome of importing one car
+type ImportResult struct {
+	CarNumber string `json:"carNumber"`
+	Imported  bool   `json:"imported"`
+	Error     string `json:"error,omitempty" metadata:",optional"`
+}
+
+// ExportPage structure used for returning a page of exported cars. Cars holds
+// one JSON encoded QueryResult per line; a record that cannot be read as a
+// car is exported with its key and error so the rest of the page survives
+type ExportPage struct {
+	Cars                string `json:"cars"`
+	FetchedRecordsCount int32  `json:"fetchedRecordsCount"`
+	Bookmark            string `json:"bookmark"`
+}
+
+// ImportCars adds up to maxImportCars cars in one transaction, owned by the
+// submitting client. Each car is validated as in CreateCar; invalid cars are
+// skipped and the outcome for every car is reported
+func (s *SmartContract) ImportCars(ctx contractapi.TransactionContextInterface, cars []CarImport) ([]ImportResult, error) {
+	if len(cars) == 0 {
+		return nil, newError(ErrInvalidArgument, "no cars to import")
+	}
+
+	if len(cars) > maxImportCars {
+		return nil, newError(ErrInvalidArgument, "cannot import %d cars, the limit is %d", len(cars), maxImportCars)
+	}
+
+	ownerID, err := clientID(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Writes made earlier in the transaction cannot be read back, so
+	// duplicates within the batch are tracked here
+	carNumbers := map[string]bool{}
+	vins := map[string]bool{}
+	results := []ImportResult{}
+
+	for _, imp := range cars {
+		car := Car{
+			DocType: docTypeCar,
+			Make:    imp.Make,
+			Model:   imp.Model,
+			Colour:  imp.Colour,
+			Owner:   imp.Owner,
+			VIN:     normalizeVIN(imp.VIN),
+			OwnerID: ownerID,
+			Status:  StatusRegistered,
+		}
+
+		var importErr error
+
+		if carNumbers[imp.CarNumber] {
+			importErr = newError(ErrCarExists, "%s appears more than once in the import", imp.CarNumber)
+		} else if vins[car.VIN] {
+			importErr = newError(ErrVINExists, "VIN %s appears more than once in the import", car.VIN)
+		} else {
+			importErr = s.addCar(ctx, imp.CarNumber, &car)
+		}
+
+		result := ImportResult{CarNumber: imp.CarNumber, Imported: importErr == nil}
+
+		if importErr != nil {
+			// Only validation failures are reported per car, anything else
+			// fails the whole import
+			if _, ok := importErr.(*ContractError); !ok {
+				return nil, importErr
+			}
+
+			result.Error = importErr.Error()
+		} else {
+			carNumbers[imp.CarNumber] = true
+			vins[car.VIN] = true
+		}
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// ExportCars returns a page of all cars in world state as JSON lines, for
+// backups and migrations. The bookmark returned with a page is passed back
+// in to fetch the next one
+func (s *SmartContract) ExportCars(ctx contractapi.TransactionContextInterface, pageSize int32, bookmark string) (*ExportPage, error) {
+	if pageSize <= 0 {
+		return nil, newError(ErrInvalidArgument, "page size must be greater than zero")
+	}
+
+	resultsIterator, metadata, err := ctx.GetStub().GetStateByRangeWithPagination("", "", pageSize, bookmark)
+
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var buffer bytes.Buffer
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+
+		if err != nil {
+			return nil, err
+		}
+
+		queryResult, err := queryResult(queryResponse.Key, queryResponse.Value)
+
+		if err != nil {
+			return nil, err
+		}
+
+		line, err := json.Marshal(queryResult)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to marshal car %s. %s", queryResponse.Key, err.Error())
+		}
+
+		buffer.Write(line)
+		buffer.WriteString("\n")
+	}
+
+	return &ExportPage{
+		Cars:                buffer.String(),
+		FetchedRecordsCount: metadata.FetchedRecordsCount,
+		Bookmark:            metadata.Bookmark,
+	}, nil
+}
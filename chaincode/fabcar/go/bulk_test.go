@@ -0,0 +1,139 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestImportCars(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+	createCar(t, ctx, "CAR1", vin1)
+
+	cars := []CarImport{
+		{CarNumber: "CAR2", Make: "Ford", Model: "Mustang", Colour: "red", Owner: "Brad", VIN: vin2},
+		{CarNumber: "CAR1", Make: "Ford", Model: "Focus", Colour: "red", Owner: "Brad", VIN: vin3},
+		{CarNumber: "CAR2", Make: "Ford", Model: "Focus", Colour: "red", Owner: "Brad", VIN: vin3},
+		{CarNumber: "CAR3", Make: "Ford", Model: "Focus", Colour: "red", Owner: "Brad", VIN: vin2},
+		{CarNumber: "CAR4", Make: "", Model: "Focus", Colour: "red", Owner: "Brad", VIN: vin3},
+		{CarNumber: "CAR5", Make: "Ford", Model: "Ka", Colour: "red", Owner: "Brad", VIN: strings.ToLower(vin3)},
+	}
+
+	results, err := s.ImportCars(ctx.as(bob), cars)
+	assertNoError(t, err)
+
+	expected := []struct {
+		imported bool
+		code     ErrorCode
+	}{
+		{true, ""},
+		{false, ErrCarExists},
+		{false, ErrCarExists},
+		{false, ErrVINExists},
+		{false, ErrInvalidArgument},
+		{true, ""},
+	}
+
+	for i, result := range results {
+		if result.Imported != expected[i].imported || !strings.HasPrefix(result.Error, string(expected[i].code)) {
+			t.Errorf("unexpected result for car %d: %+v", i, result)
+		}
+	}
+
+	car, err := s.QueryCar(ctx.as(bob), "CAR5")
+	assertNoError(t, err)
+
+	if car.OwnerID != "bob" || car.VIN != vin3 {
+		t.Fatalf("unexpected imported car %+v", car)
+	}
+}
+
+func TestImportCars_Limits(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+
+	_, err := s.ImportCars(ctx.as(alice), []CarImport{})
+	assertCode(t, err, ErrInvalidArgument)
+
+	_, err = s.ImportCars(ctx.as(alice), make([]CarImport, maxImportCars+1))
+	assertCode(t, err, ErrInvalidArgument)
+}
+
+func TestExportCars(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+	createCar(t, ctx, "CAR1", vin1)
+	createCar(t, ctx, "CAR2", vin2)
+	createCar(t, ctx, "CAR3", vin3)
+
+	keys := []string{}
+	bookmark := ""
+
+	for {
+		page, err := s.ExportCars(ctx.as(alice), 2, bookmark)
+		assertNoError(t, err)
+
+		if page.FetchedRecordsCount == 0 {
+			break
+		}
+
+		lines := strings.Split(strings.TrimSuffix(page.Cars, "\n"), "\n")
+		if int32(len(lines)) != page.FetchedRecordsCount {
+			t.Fatalf("expected %d lines, got %q", page.FetchedRecordsCount, page.Cars)
+		}
+
+		for _, line := range lines {
+			var result QueryResult
+			assertNoError(t, json.Unmarshal([]byte(line), &result))
+			keys = append(keys, result.Key)
+		}
+
+		bookmark = page.Bookmark
+	}
+
+	if strings.Join(keys, ",") != "CAR1,CAR2,CAR3" {
+		t.Fatalf("unexpected export %v", keys)
+	}
+}
+
+func TestExportCars_Invalid(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+
+	_, err := s.ExportCars(ctx.as(alice), 0, "")
+	assertCode(t, err, ErrInvalidArgument)
+
+}
+
+func TestExportCars_Malformed(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+	ctx.putRaw(t, "CAR1", "not json")
+	createCar(t, ctx, "CAR2", vin2)
+
+	page, err := s.ExportCars(ctx.as(alice), 10, "")
+	assertNoError(t, err)
+
+	lines := strings.Split(strings.TrimSuffix(page.Cars, "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %q", page.Cars)
+	}
+
+	var results [2]QueryResult
+	for i, line := range lines {
+		assertNoError(t, json.Unmarshal([]byte(line), &results[i]))
+	}
+
+	if results[0].Key != "CAR1" || results[0].Record != nil || !strings.HasPrefix(results[0].Error, string(ErrMalformedRecord)) {
+		t.Fatalf("expected CAR1 to be reported as malformed, got %+v", results[0])
+	}
+
+	if results[1].Key != "CAR2" || results[1].Record == nil || results[1].Error != "" {
+		t.Fatalf("expected CAR2 to be exported, got %+v", results[1])
+	}
+}
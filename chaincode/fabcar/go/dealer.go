@@ -0,0 +1,317 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// dealerIndex is the composite key prefix for registered dealers
+const dealerIndex = "dealer~dealerId"
+
+// listingIndex is the composite key prefix for cars listed by a dealer
+const listingIndex = "listing~dealerId~carNumber"
+
+// DealerContract provides functions for managing dealers and the cars they
+// list for sale. It shares the car records of the car contract
+type DealerContract struct {
+	contractapi.Contract
+	cars SmartContract
+}
+
+// Dealer describes a registered dealer and the client identity it trades as
+type Dealer struct {
+	DealerID string `json:"dealerId"`
+	Name     string `json:"name"`
+	ClientID string `json:"clientId"`
+}
+
+// Listing describes a car a dealer has listed for sale
+type Listing struct {
+	CarNumber string  `json:"carNumber"`
+	DealerID  string  `json:"dealerId"`
+	Price     float64 `json:"price"`
+	TxID      string  `json:"txId"`
+}
+
+func dealerKey(ctx contractapi.TransactionContextInterface, dealerID string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(dealerIndex, []string{dealerID})
+}
+
+func listingKey(ctx contractapi.TransactionContextInterface, dealerID string, carNumber string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(listingIndex, []string{dealerID, carNumber})
+}
+
+// assertDealer returns the dealer with given id, or an error unless the
+// submitting client trades as that dealer
+func (d *DealerContract) assertDealer(ctx contractapi.TransactionContextInterface, dealerID string) (*Dealer, error) {
+	dealer, err := d.QueryDealer(ctx, dealerID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := clientID(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if dealer.ClientID != id {
+		return nil, newError(ErrForbidden, "only dealer %s may do this", dealerID)
+	}
+
+	return dealer, nil
+}
+
+// RegisterDealer adds a dealer trading as the client identified by
+// dealerClientID. Only a registry admin may register dealers
+func (d *DealerContract) RegisterDealer(ctx contractapi.TransactionContextInterface, dealerID string, name string, dealerClientID string) error {
+	if !isRegistryAdmin(ctx) {
+		return newError(ErrForbidden, "only a registry admin may register dealers")
+	}
+
+	dealer := Dealer{DealerID: dealerID, Name: name, ClientID: dealerClientID}
+	fields := []struct {
+		name  string
+		value string
+	}{
+		{"dealer id", dealer.DealerID},
+		{"name", dealer.Name},
+		{"client identity", dealer.ClientID},
+	}
+
+	for _, field := range fields {
+		if strings.TrimSpace(field.value) == "" {
+			return newError(ErrInvalidArgument, "%s must not be empty", field.name)
+		}
+	}
+
+	key, err := dealerKey(ctx, dealerID)
+
+	if err != nil {
+		return err
+	}
+
+	existing, err := ctx.GetStub().GetState(key)
+
+	if err != nil {
+		return fmt.Errorf("Failed to read from world state. %s", err.Error())
+	}
+
+	if existing != nil {
+		return newError(ErrDealerExists, "dealer %s already exists", dealerID)
+	}
+
+	dealerAsBytes, err := json.Marshal(dealer)
+
+	if err != nil {
+		return fmt.Errorf("Failed to marshal dealer %s. %s", dealerID, err.Error())
+	}
+
+	return ctx.GetStub().PutState(key, dealerAsBytes)
+}
+
+// QueryDealer returns the dealer with given id
+func (d *DealerContract) QueryDealer(ctx contractapi.TransactionContextInterface, dealerID string) (*Dealer, error) {
+	key, err := dealerKey(ctx, dealerID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	dealerAsBytes, err := ctx.GetStub().GetState(key)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read from world state. %s", err.Error())
+	}
+
+	if dealerAsBytes == nil {
+		return nil, newError(ErrDealerNotFound, "dealer %s does not exist", dealerID)
+	}
+
+	dealer := new(Dealer)
+
+	if err := json.Unmarshal(dealerAsBytes, dealer); err != nil {
+		return nil, fmt.Errorf("Failed to read dealer %s. %s", dealerID, err.Error())
+	}
+
+	return dealer, nil
+}
+
+// DeregisterDealer removes the dealer with given id along with its listings.
+// Only a registry admin may deregister dealers
+func (d *DealerContract) DeregisterDealer(ctx contractapi.TransactionContextInterface, dealerID string) error {
+	if !isRegistryAdmin(ctx) {
+		return newError(ErrForbidden, "only a registry admin may deregister dealers")
+	}
+
+	if _, err := d.QueryDealer(ctx, dealerID); err != nil {
+		return err
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(listingIndex, []string{dealerID})
+
+	if err != nil {
+		return fmt.Errorf("Failed to read from world state. %s", err.Error())
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+
+		if err != nil {
+			return err
+		}
+
+		if err := ctx.GetStub().DelState(queryResponse.Key); err != nil {
+			return err
+		}
+	}
+
+	key, err := dealerKey(ctx, dealerID)
+
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().DelState(key)
+}
+
+// ListCar lists the car with given id for sale by the dealer at the given
+// price, moving it to the ForSale state if needed. The dealer must own the
+// car. Listing a car again updates its price
+func (d *DealerContract) ListCar(ctx contractapi.TransactionContextInterface, dealerID string, carNumber string, price float64) error {
+	if price <= 0 {
+		return newError(ErrInvalidArgument, "price must be greater than zero")
+	}
+
+	if _, err := d.assertDealer(ctx, dealerID); err != nil {
+		return err
+	}
+
+	car, err := d.cars.QueryCar(ctx, carNumber)
+
+	if err != nil {
+		return err
+	}
+
+	if err := assertOwner(ctx, carNumber, car); err != nil {
+		return err
+	}
+
+	if car.CurrentStatus() != StatusForSale {
+		if err := car.transition(carNumber, StatusForSale); err != nil {
+			return err
+		}
+
+		if err := d.cars.putCar(ctx, carNumber, car); err != nil {
+			return err
+		}
+	}
+
+	listing := Listing{
+		CarNumber: carNumber,
+		DealerID:  dealerID,
+		Price:     price,
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+
+	listingAsBytes, err := json.Marshal(listing)
+
+	if err != nil {
+		return fmt.Errorf("Failed to marshal listing of %s. %s", carNumber, err.Error())
+	}
+
+	key, err := listingKey(ctx, dealerID, carNumber)
+
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState(key, listingAsBytes)
+}
+
+// DelistCar withdraws the dealer's listing of the car with given id. The car
+// keeps its lifecycle state
+func (d *DealerContract) DelistCar(ctx contractapi.TransactionContextInterface, dealerID string, carNumber string) error {
+	if _, err := d.assertDealer(ctx, dealerID); err != nil {
+		return err
+	}
+
+	key, err := listingKey(ctx, dealerID, carNumber)
+
+	if err != nil {
+		return err
+	}
+
+	listingAsBytes, err := ctx.GetStub().GetState(key)
+
+	if err != nil {
+		return fmt.Errorf("Failed to read from world state. %s", err.Error())
+	}
+
+	if listingAsBytes == nil {
+		return newError(ErrListingNotFound, "%s is not listed by dealer %s", carNumber, dealerID)
+	}
+
+	return ctx.GetStub().DelState(key)
+}
+
+// QueryListings returns the cars the dealer with given id has listed for
+// sale. Listings of cars that have since changed hands or left the ForSale
+// state are left out
+func (d *DealerContract) QueryListings(ctx contractapi.TransactionContextInterface, dealerID string) ([]Listing, error) {
+	dealer, err := d.QueryDealer(ctx, dealerID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(listingIndex, []string{dealerID})
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read from world state. %s", err.Error())
+	}
+	defer resultsIterator.Close()
+
+	listings := []Listing{}
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+
+		if err != nil {
+			return nil, err
+		}
+
+		var listing Listing
+
+		if err := json.Unmarshal(queryResponse.Value, &listing); err != nil {
+			return nil, fmt.Errorf("Failed to read listing %s. %s", queryResponse.Key, err.Error())
+		}
+
+		car, err := d.cars.QueryCar(ctx, listing.CarNumber)
+
+		if err != nil {
+			if ce, ok := err.(*ContractError); ok && ce.Code == ErrCarNotFound {
+				continue
+			}
+
+			return nil, err
+		}
+
+		if car.OwnerID != dealer.ClientID || car.CurrentStatus() != StatusForSale {
+			continue
+		}
+
+		listings = append(listings, listing)
+	}
+
+	return listings, nil
+}
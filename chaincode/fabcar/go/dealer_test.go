@@ -0,0 +1,152 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package main
+
+import (
+	"testing"
+)
+
+// registerDealer registers alice as dealer DEALER1
+func registerDealer(t *testing.T, ctx *fakeContext) {
+	t.Helper()
+	d := new(DealerContract)
+	assertNoError(t, d.RegisterDealer(ctx.as(admin), "DEALER1", "Alice's Autos", "alice"))
+}
+
+func TestRegisterDealer(t *testing.T) {
+	ctx := newFakeContext()
+	d := new(DealerContract)
+
+	assertCode(t, d.RegisterDealer(ctx.as(alice), "DEALER1", "Alice's Autos", "alice"), ErrForbidden)
+	assertCode(t, d.RegisterDealer(ctx.as(admin), "DEALER1", " ", "alice"), ErrInvalidArgument)
+	assertCode(t, d.RegisterDealer(ctx.as(admin), "DEALER1", "Alice's Autos", ""), ErrInvalidArgument)
+	registerDealer(t, ctx)
+	assertCode(t, d.RegisterDealer(ctx.as(admin), "DEALER1", "Bob's Autos", "bob"), ErrDealerExists)
+
+	dealer, err := d.QueryDealer(ctx.as(bob), "DEALER1")
+	assertNoError(t, err)
+
+	expected := Dealer{DealerID: "DEALER1", Name: "Alice's Autos", ClientID: "alice"}
+	if *dealer != expected {
+		t.Fatalf("expected %+v, got %+v", expected, *dealer)
+	}
+
+	_, err = d.QueryDealer(ctx.as(bob), "DEALER2")
+	assertCode(t, err, ErrDealerNotFound)
+}
+
+func TestListCar(t *testing.T) {
+	ctx := newFakeContext()
+	d := new(DealerContract)
+	registerDealer(t, ctx)
+	createCar(t, ctx, "CAR1", vin1)
+	createCar(t, ctx, "CAR2", vin2)
+
+	assertCode(t, d.ListCar(ctx.as(bob), "DEALER1", "CAR1", 9000), ErrForbidden)
+	assertCode(t, d.ListCar(ctx.as(alice), "DEALER2", "CAR1", 9000), ErrDealerNotFound)
+	assertCode(t, d.ListCar(ctx.as(alice), "DEALER1", "CAR1", 0), ErrInvalidArgument)
+	assertCode(t, d.ListCar(ctx.as(alice), "DEALER1", "CAR3", 9000), ErrCarNotFound)
+
+	assertNoError(t, d.ListCar(ctx.as(alice), "DEALER1", "CAR1", 9000))
+	assertNoError(t, d.ListCar(ctx.as(alice), "DEALER1", "CAR2", 8000))
+	assertNoError(t, d.ListCar(ctx.as(alice), "DEALER1", "CAR1", 8500))
+
+	car, err := d.cars.QueryCar(ctx.as(alice), "CAR1")
+	assertNoError(t, err)
+
+	if car.Status != StatusForSale {
+		t.Fatalf("expected the listed car to be for sale, got %s", car.Status)
+	}
+
+	listings, err := d.QueryListings(ctx.as(bob), "DEALER1")
+	assertNoError(t, err)
+
+	if len(listings) != 2 || listings[0].CarNumber != "CAR1" || listings[0].Price != 8500 || listings[1].CarNumber != "CAR2" {
+		t.Fatalf("unexpected listings %+v", listings)
+	}
+}
+
+func TestListCar_NotOwner(t *testing.T) {
+	ctx := newFakeContext()
+	d := new(DealerContract)
+	assertNoError(t, d.RegisterDealer(ctx.as(admin), "DEALER2", "Bob's Autos", "bob"))
+	createCar(t, ctx, "CAR1", vin1)
+
+	assertCode(t, d.ListCar(ctx.as(bob), "DEALER2", "CAR1", 9000), ErrForbidden)
+}
+
+func TestQueryListings_Stale(t *testing.T) {
+	ctx := newFakeContext()
+	d := new(DealerContract)
+	registerDealer(t, ctx)
+	createCar(t, ctx, "CAR1", vin1)
+	createCar(t, ctx, "CAR2", vin2)
+	createCar(t, ctx, "CAR3", vin3)
+	assertNoError(t, d.ListCar(ctx.as(alice), "DEALER1", "CAR1", 9000))
+	assertNoError(t, d.ListCar(ctx.as(alice), "DEALER1", "CAR2", 9000))
+	assertNoError(t, d.ListCar(ctx.as(alice), "DEALER1", "CAR3", 9000))
+
+	// CAR1 is sold, CAR2 is stolen and CAR3 is deleted
+	assertNoError(t, d.cars.ChangeCarOwner(ctx.as(alice), "CAR1", "Bob", "bob", 0))
+	assertNoError(t, d.cars.AcceptCarTransfer(ctx.as(bob), "CAR1"))
+	assertNoError(t, d.cars.ReportStolen(ctx.as(alice), "CAR2"))
+	assertNoError(t, d.cars.DeleteCar(ctx.as(alice), "CAR3"))
+
+	listings, err := d.QueryListings(ctx.as(alice), "DEALER1")
+	assertNoError(t, err)
+
+	if len(listings) != 0 {
+		t.Fatalf("expected no listings, got %+v", listings)
+	}
+}
+
+func TestDelistCar(t *testing.T) {
+	ctx := newFakeContext()
+	d := new(DealerContract)
+	registerDealer(t, ctx)
+	createCar(t, ctx, "CAR1", vin1)
+	assertNoError(t, d.ListCar(ctx.as(alice), "DEALER1", "CAR1", 9000))
+
+	assertCode(t, d.DelistCar(ctx.as(bob), "DEALER1", "CAR1"), ErrForbidden)
+	assertNoError(t, d.DelistCar(ctx.as(alice), "DEALER1", "CAR1"))
+	assertCode(t, d.DelistCar(ctx.as(alice), "DEALER1", "CAR1"), ErrListingNotFound)
+
+	listings, err := d.QueryListings(ctx.as(alice), "DEALER1")
+	assertNoError(t, err)
+
+	if len(listings) != 0 {
+		t.Fatalf("expected no listings, got %+v", listings)
+	}
+}
+
+func TestDeregisterDealer(t *testing.T) {
+	ctx := newFakeContext()
+	d := new(DealerContract)
+	registerDealer(t, ctx)
+	createCar(t, ctx, "CAR1", vin1)
+	assertNoError(t, d.ListCar(ctx.as(alice), "DEALER1", "CAR1", 9000))
+
+	assertCode(t, d.DeregisterDealer(ctx.as(alice), "DEALER1"), ErrForbidden)
+	assertCode(t, d.DeregisterDealer(ctx.as(admin), "DEALER2"), ErrDealerNotFound)
+	assertNoError(t, d.DeregisterDealer(ctx.as(admin), "DEALER1"))
+
+	_, err := d.QueryDealer(ctx.as(alice), "DEALER1")
+	assertCode(t, err, ErrDealerNotFound)
+
+	key, _ := listingKey(ctx, "DEALER1", "CAR1")
+	if ctx.stub.State[key] != nil {
+		t.Fatal("expected the listing to be removed with the dealer")
+	}
+
+	// Re-registering the dealer does not bring back its listings
+	registerDealer(t, ctx)
+
+	listings, err := d.QueryListings(ctx.as(alice), "DEALER1")
+	assertNoError(t, err)
+
+	if len(listings) != 0 {
+		t.Fatalf("expected no listings, got %+v", listings)
+	}
+}
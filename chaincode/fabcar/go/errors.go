@@ -0,0 +1,76 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ErrorCode identifies the kind of failure a transaction reports to clients
+type ErrorCode string
+
+// Error codes returned by the contract
+const (
+	ErrInvalidArgument  ErrorCode = "INVALID_ARGUMENT"
+	ErrCarExists        ErrorCode = "CAR_EXISTS"
+	ErrCarNotFound      ErrorCode = "CAR_NOT_FOUND"
+	ErrVINExists        ErrorCode = "VIN_EXISTS"
+	ErrForbidden        ErrorCode = "FORBIDDEN"
+	ErrTransferNotFound ErrorCode = "TRANSFER_NOT_FOUND"
+	ErrInvalidState     ErrorCode = "INVALID_STATE"
+	ErrMileageDecreased ErrorCode = "MILEAGE_DECREASED"
+	ErrSaleNotFound     ErrorCode = "SALE_NOT_FOUND"
+	ErrDealerExists     ErrorCode = "DEALER_EXISTS"
+	ErrDealerNotFound   ErrorCode = "DEALER_NOT_FOUND"
+	ErrListingNotFound  ErrorCode = "LISTING_NOT_FOUND"
+	ErrMalformedRecord  ErrorCode = "MALFORMED_RECORD"
+)
+
+// errorCodes describes each error code for the contract metadata
+var errorCodes = []struct {
+	Code        ErrorCode
+	Description string
+}{
+	{ErrInvalidArgument, "an argument is missing or malformed"},
+	{ErrCarExists, "a car with the given number already exists"},
+	{ErrCarNotFound, "no car with the given number exists"},
+	{ErrVINExists, "another car is registered with the given VIN"},
+	{ErrForbidden, "the client may not perform the operation"},
+	{ErrTransferNotFound, "the car has no pending transfer"},
+	{ErrInvalidState, "the car's lifecycle state does not allow the operation"},
+	{ErrMileageDecreased, "the mileage is lower than the last recorded reading"},
+	{ErrSaleNotFound, "the car has no recorded sale details"},
+	{ErrDealerExists, "a dealer with the given id already exists"},
+	{ErrDealerNotFound, "no dealer with the given id exists"},
+	{ErrListingNotFound, "the dealer has not listed the car"},
+	{ErrMalformedRecord, "a stored record cannot be read or has an unsupported schema version"},
+}
+
+// ContractError is returned by transactions for failures the client can act
+// on. Its message starts with the code so clients can tell errors apart.
+type ContractError struct {
+	Code    ErrorCode
+	Message string
+}
+
+func (e *ContractError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+func newError(code ErrorCode, format string, args ...interface{}) *ContractError {
+	return &ContractError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// errorCodesDescription lists the error codes for the contract description
+func errorCodesDescription() string {
+	lines := []string{"Errors are reported as \"CODE: message\" with the following codes:"}
+
+	for _, ec := range errorCodes {
+		lines = append(lines, fmt.Sprintf("%s - %s", ec.Code, ec.Description))
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,81 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Names of the chaincode events emitted by the contract
+const (
+	EventCarCreated   = "CarCreated"
+	EventOwnerChanged = "OwnerChanged"
+	EventCarDeleted   = "CarDeleted"
+)
+
+// CarCreatedEvent is the payload of the CarCreated event
+type CarCreatedEvent struct {
+	CarNumber string `json:"carNumber"`
+	Car       *Car   `json:"car"`
+	TxID      string `json:"txId"`
+}
+
+// OwnerChangedEvent is the payload of the OwnerChanged event
+type OwnerChangedEvent struct {
+	CarNumber       string `json:"carNumber"`
+	PreviousOwner   string `json:"previousOwner"`
+	PreviousOwnerID string `json:"previousOwnerId"`
+	NewOwner        string `json:"newOwner"`
+	NewOwnerID      string `json:"newOwnerId"`
+	Mileage         uint64 `json:"mileage"`
+	TxID            string `json:"txId"`
+}
+
+// CarDeletedEvent is the payload of the CarDeleted event
+type CarDeletedEvent struct {
+	CarNumber string `json:"carNumber"`
+	TxID      string `json:"txId"`
+}
+
+// eventTypes holds an example payload of each event the contract emits, for
+// the contract metadata
+var eventTypes = []struct {
+	Name    string
+	Payload interface{}
+}{
+	{EventCarCreated, CarCreatedEvent{Car: &Car{}}},
+	{EventOwnerChanged, OwnerChangedEvent{}},
+	{EventCarDeleted, CarDeletedEvent{}},
+}
+
+// setEvent emits the named event with the JSON encoded payload. A
+// transaction carries at most one event, so a later call replaces it
+func setEvent(ctx contractapi.TransactionContextInterface, name string, payload interface{}) error {
+	payloadAsBytes, err := json.Marshal(payload)
+
+	if err != nil {
+		return fmt.Errorf("Failed to marshal %s event. %s", name, err.Error())
+	}
+
+	return ctx.GetStub().SetEvent(name, payloadAsBytes)
+}
+
+// eventTypesDescription lists the events and the shape of their payloads for
+// the contract description, so clients can generate decoders from the
+// metadata
+func eventTypesDescription() string {
+	lines := []string{"Events are emitted with JSON payloads of the following shapes:"}
+
+	for _, et := range eventTypes {
+		payloadAsBytes, _ := json.Marshal(et.Payload)
+		lines = append(lines, fmt.Sprintf("%s - %s", et.Name, payloadAsBytes))
+	}
+
+	return strings.Join(lines, "\n")
+}
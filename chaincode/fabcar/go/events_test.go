@@ -0,0 +1,109 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+)
+
+func TestEvents(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+
+	createCar(t, ctx, "CAR1", vin1)
+	event := ctx.lastEvent(t)
+
+	var created CarCreatedEvent
+	assertNoError(t, json.Unmarshal(event.Payload, &created))
+
+	if event.EventName != EventCarCreated || created.CarNumber != "CAR1" || created.Car.VIN != vin1 || created.TxID != ctx.stub.TxID {
+		t.Fatalf("unexpected event %s %s", event.EventName, event.Payload)
+	}
+
+	offerCar(t, ctx, "CAR1", 500)
+	assertNoError(t, s.AcceptCarTransfer(ctx.as(bob), "CAR1"))
+	event = ctx.lastEvent(t)
+
+	var changed OwnerChangedEvent
+	assertNoError(t, json.Unmarshal(event.Payload, &changed))
+
+	expected := OwnerChangedEvent{CarNumber: "CAR1", PreviousOwner: "Tomoko", PreviousOwnerID: "alice", NewOwner: "Bob", NewOwnerID: "bob", Mileage: 500, TxID: ctx.stub.TxID}
+	if event.EventName != EventOwnerChanged || changed != expected {
+		t.Fatalf("unexpected event %s %s", event.EventName, event.Payload)
+	}
+
+	assertNoError(t, s.DeleteCar(ctx.as(bob), "CAR1"))
+	event = ctx.lastEvent(t)
+
+	var deleted CarDeletedEvent
+	assertNoError(t, json.Unmarshal(event.Payload, &deleted))
+
+	if event.EventName != EventCarDeleted || deleted.CarNumber != "CAR1" {
+		t.Fatalf("unexpected event %s %s", event.EventName, event.Payload)
+	}
+}
+
+func TestEvents_NotEmittedOnFailure(t *testing.T) {
+	ctx := newFakeContext()
+	createCar(t, ctx, "CAR1", vin1)
+	count := len(ctx.stub.Events)
+
+	s := new(SmartContract)
+	assertCode(t, s.CreateCar(ctx.as(alice), "CAR1", "Ford", "Ka", "red", "Brad", vin2), ErrCarExists)
+
+	if len(ctx.stub.Events) != count {
+		t.Fatal("expected no event for a failed transaction")
+	}
+}
+
+func TestEventTypesMetadata(t *testing.T) {
+	chaincode, err := newChaincode()
+	assertNoError(t, err)
+
+	stub := shimtest.NewMockStub("fabcar", chaincode)
+	response := stub.MockInvoke("tx1", [][]byte{[]byte("org.hyperledger.fabric:GetMetadata")})
+
+	if response.Status != shim.OK {
+		t.Fatalf("failed to read metadata: %s", response.Message)
+	}
+
+	var contractMetadata struct {
+		Contracts map[string]struct {
+			Info struct {
+				Description string `json:"description"`
+			} `json:"info"`
+			Transactions []struct {
+				Name string `json:"name"`
+			} `json:"transactions"`
+		} `json:"contracts"`
+	}
+	assertNoError(t, json.Unmarshal(response.Payload, &contractMetadata))
+
+	carContract := contractMetadata.Contracts["CarContract"]
+
+	for _, et := range eventTypes {
+		payloadAsBytes, _ := json.Marshal(et.Payload)
+
+		if !strings.Contains(carContract.Info.Description, et.Name+" - "+string(payloadAsBytes)) {
+			t.Errorf("expected the %s payload in the description, got %s", et.Name, carContract.Info.Description)
+		}
+	}
+
+	// The event types are published as metadata, not as a transaction
+	if len(carContract.Transactions) == 0 {
+		t.Fatal("expected the CarContract transactions in the metadata")
+	}
+
+	for _, tx := range carContract.Transactions {
+		if strings.Contains(tx.Name, "Event") {
+			t.Errorf("unexpected transaction %s", tx.Name)
+		}
+	}
+}
@@ -22,9 +22,12 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"regexp"
 	"strconv"
+	"strings"
 
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-contract-api-go/metadata"
 )
 
 // SmartContract provides functions for managing a car
@@ -32,62 +35,234 @@ type SmartContract struct {
 	contractapi.Contract
 }
 
+// docTypeCar identifies car records in CouchDB rich queries
+const docTypeCar = "car"
+
+var carNumberPattern = regexp.MustCompile(`^CAR[0-9]+$`)
+
 // Car describes basic details of what makes up a car
 type Car struct {
-	Make   string `json:"make"`
-	Model  string `json:"model"`
-	Colour string `json:"colour"`
-	Owner  string `json:"owner"`
+	DocType string `json:"docType"`
+	Make    string `json:"make"`
+	Model   string `json:"model"`
+	Colour  string `json:"colour"`
+	Owner   string `json:"owner"`
+	VIN     string `json:"vin,omitempty" metadata:",optional"`
+	OwnerID string `json:"ownerId,omitempty" metadata:",optional"`
+	Status  string `json:"status,omitempty" metadata:",optional"`
+	Mileage uint64 `json:"mileage"`
+
+	SchemaVersion int `json:"schemaVersion"`
 }
 
-// QueryResult structure used for handling result of query
+// QueryResult structure used for handling result of query. Records that
+// cannot be read are returned with an error in place of the car
 type QueryResult struct {
 	Key    string `json:"Key"`
-	Record *Car
+	Record *Car   `json:"Record,omitempty" metadata:",optional"`
+	Error  string `json:"error,omitempty" metadata:",optional"`
 }
 
-// InitLedger adds a base set of cars to the ledger
+// PaginatedQueryResult structure used for handling a page of query results.
+// Records always holds a []QueryResult. It is declared as an interface as the
+// contract API cannot yet describe a slice of structs nested in a struct.
+type PaginatedQueryResult struct {
+	Records             interface{} `json:"records"`
+	FetchedRecordsCount int32       `json:"fetchedRecordsCount"`
+	Bookmark            string      `json:"bookmark"`
+}
+
+// InitLedger adds a base set of cars to the ledger, owned by the submitting
+// client
 func (s *SmartContract) InitLedger(ctx contractapi.TransactionContextInterface) error {
 	cars := []Car{
-		Car{Make: "Toyota", Model: "Prius", Colour: "blue", Owner: "Tomoko"},
-		Car{Make: "Ford", Model: "Mustang", Colour: "red", Owner: "Brad"},
-		Car{Make: "Hyundai", Model: "Tucson", Colour: "green", Owner: "Jin Soo"},
-		Car{Make: "Volkswagen", Model: "Passat", Colour: "yellow", Owner: "Max"},
-		Car{Make: "Tesla", Model: "S", Colour: "black", Owner: "Adriana"},
-		Car{Make: "Peugeot", Model: "205", Colour: "purple", Owner: "Michel"},
-		Car{Make: "Chery", Model: "S22L", Colour: "white", Owner: "Aarav"},
-		Car{Make: "Fiat", Model: "Punto", Colour: "violet", Owner: "Pari"},
-		Car{Make: "Tata", Model: "Nano", Colour: "indigo", Owner: "Valeria"},
-		Car{Make: "Holden", Model: "Barina", Colour: "brown", Owner: "Shotaro"},
+		Car{Make: "Toyota", Model: "Prius", Colour: "blue", Owner: "Tomoko", VIN: "JTDKB20U5C3000001"},
+		Car{Make: "Ford", Model: "Mustang", Colour: "red", Owner: "Brad", VIN: "1FAFP4044YF000002"},
+		Car{Make: "Hyundai", Model: "Tucson", Colour: "green", Owner: "Jin Soo", VIN: "KM8J33A48GU000003"},
+		Car{Make: "Volkswagen", Model: "Passat", Colour: "yellow", Owner: "Max", VIN: "WVWZZZ3C79E000004"},
+		Car{Make: "Tesla", Model: "S", Colour: "black", Owner: "Adriana", VIN: "5YJSA1E26GF000005"},
+		Car{Make: "Peugeot", Model: "205", Colour: "purple", Owner: "Michel", VIN: "VF3CA5FV1JW000006"},
+		Car{Make: "Chery", Model: "S22L", Colour: "white", Owner: "Aarav", VIN: "LVVDB11B2ED000007"},
+		Car{Make: "Fiat", Model: "Punto", Colour: "violet", Owner: "Pari", VIN: "ZFA18800X00000008"},
+		Car{Make: "Tata", Model: "Nano", Colour: "indigo", Owner: "Valeria", VIN: "MAT60000600000009"},
+		Car{Make: "Holden", Model: "Barina", Colour: "brown", Owner: "Shotaro", VIN: "6G1ZX69W69L000010"},
+	}
+
+	ownerID, err := clientID(ctx)
+
+	if err != nil {
+		return err
 	}
 
 	for i, car := range cars {
+		car.DocType = docTypeCar
+		car.OwnerID = ownerID
+		car.Status = StatusRegistered
+		car.SchemaVersion = carSchemaVersion
 		carAsBytes, _ := json.Marshal(car)
 		err := ctx.GetStub().PutState("CAR"+strconv.Itoa(i), carAsBytes)
 
 		if err != nil {
 			return fmt.Errorf("Failed to put to world state. %s", err.Error())
 		}
+
+		if err := s.putVINIndex(ctx, car.VIN, "CAR"+strconv.Itoa(i)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Validate checks that all details of the car are filled in
+func (c *Car) Validate() error {
+	fields := []struct {
+		name  string
+		value string
+	}{
+		{"make", c.Make},
+		{"model", c.Model},
+		{"colour", c.Colour},
+		{"owner", c.Owner},
+	}
+
+	for _, field := range fields {
+		if strings.TrimSpace(field.value) == "" {
+			return newError(ErrInvalidArgument, "%s must not be empty", field.name)
+		}
 	}
 
 	return nil
 }
 
-// CreateCar adds a new car to the world state with given details
-func (s *SmartContract) CreateCar(ctx contractapi.TransactionContextInterface, carNumber string, make string, model string, colour string, owner string) error {
+// validateCarNumber checks that carNumber has the form CAR followed by digits
+func validateCarNumber(carNumber string) error {
+	if !carNumberPattern.MatchString(carNumber) {
+		return newError(ErrInvalidArgument, "car number %q must be CAR followed by digits", carNumber)
+	}
+
+	return nil
+}
+
+// carExists returns true when a car with given id exists in world state
+func (s *SmartContract) carExists(ctx contractapi.TransactionContextInterface, carNumber string) (bool, error) {
+	carAsBytes, err := ctx.GetStub().GetState(carNumber)
+
+	if err != nil {
+		return false, fmt.Errorf("Failed to read from world state. %s", err.Error())
+	}
+
+	return carAsBytes != nil, nil
+}
+
+// putCar writes the car to world state under given id in the current schema
+// version
+func (s *SmartContract) putCar(ctx contractapi.TransactionContextInterface, carNumber string, car *Car) error {
+	car.SchemaVersion = carSchemaVersion
+	carAsBytes, err := json.Marshal(car)
+
+	if err != nil {
+		return fmt.Errorf("Failed to marshal car %s. %s", carNumber, err.Error())
+	}
+
+	err = ctx.GetStub().PutState(carNumber, carAsBytes)
+
+	if err != nil {
+		return fmt.Errorf("Failed to put to world state. %s", err.Error())
+	}
+
+	return nil
+}
+
+// addCar validates a new car and writes it to world state along with its
+// VIN index entry
+func (s *SmartContract) addCar(ctx contractapi.TransactionContextInterface, carNumber string, car *Car) error {
+	if err := validateCarNumber(carNumber); err != nil {
+		return err
+	}
+
+	car.VIN = normalizeVIN(car.VIN)
+
+	if err := validateVIN(car.VIN); err != nil {
+		return err
+	}
+
+	if err := car.Validate(); err != nil {
+		return err
+	}
+
+	exists, err := s.carExists(ctx, carNumber)
+
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return newError(ErrCarExists, "%s already exists", carNumber)
+	}
+
+	archived, err := s.isArchived(ctx, carNumber)
+
+	if err != nil {
+		return err
+	}
+
+	if archived {
+		return newError(ErrCarExists, "%s belongs to an archived car", carNumber)
+	}
+
+	// The VIN index keeps the entries of archived cars, so their VINs stay
+	// reserved
+	existing, err := s.carNumberForVIN(ctx, car.VIN)
+
+	if err != nil {
+		return err
+	}
+
+	if existing != "" {
+		return newError(ErrVINExists, "VIN %s is already registered to %s", car.VIN, existing)
+	}
+
+	if err := s.putVINIndex(ctx, car.VIN, carNumber); err != nil {
+		return err
+	}
+
+	return s.putCar(ctx, carNumber, car)
+}
+
+// CreateCar adds a new car to the world state with given details. The
+// submitting client is recorded as the owner. Emits CarCreated
+func (s *SmartContract) CreateCar(ctx contractapi.TransactionContextInterface, carNumber string, make string, model string, colour string, owner string, vin string) error {
+	ownerID, err := clientID(ctx)
+
+	if err != nil {
+		return err
+	}
+
 	car := Car{
-		Make:   make,
-		Model:  model,
-		Colour: colour,
-		Owner:  owner,
+		DocType: docTypeCar,
+		Make:    make,
+		Model:   model,
+		Colour:  colour,
+		Owner:   owner,
+		VIN:     vin,
+		OwnerID: ownerID,
+		Status:  StatusRegistered,
 	}
 
-	carAsBytes, _ := json.Marshal(car)
+	if err := s.addCar(ctx, carNumber, &car); err != nil {
+		return err
+	}
 
-	return ctx.GetStub().PutState(carNumber, carAsBytes)
+	return setEvent(ctx, EventCarCreated, CarCreatedEvent{
+		CarNumber: carNumber,
+		Car:       &car,
+		TxID:      ctx.GetStub().GetTxID(),
+	})
 }
 
-// QueryCar returns the car stored in the world state with given id
+// QueryCar returns the car stored in the world state with given id, upgraded
+// to the current schema version
 func (s *SmartContract) QueryCar(ctx contractapi.TransactionContextInterface, carNumber string) (*Car, error) {
 	carAsBytes, err := ctx.GetStub().GetState(carNumber)
 
@@ -96,13 +271,26 @@ func (s *SmartContract) QueryCar(ctx contractapi.TransactionContextInterface, ca
 	}
 
 	if carAsBytes == nil {
-		return nil, fmt.Errorf("%s does not exist", carNumber)
+		return nil, newError(ErrCarNotFound, "%s does not exist", carNumber)
 	}
 
-	car := new(Car)
-	_ = json.Unmarshal(carAsBytes, car)
+	return decodeCar(carNumber, carAsBytes)
+}
+
+// queryResult decodes a car returned by a query, reporting a malformed record
+// in the result rather than failing the whole query
+func queryResult(key string, value []byte) (QueryResult, error) {
+	car, err := decodeCar(key, value)
 
-	return car, nil
+	if err != nil {
+		if _, ok := err.(*ContractError); !ok {
+			return QueryResult{}, err
+		}
+
+		return QueryResult{Key: key, Error: err.Error()}, nil
+	}
+
+	return QueryResult{Key: key, Record: car}, nil
 }
 
 // QueryAllCars returns all cars found in world state
@@ -126,34 +314,122 @@ func (s *SmartContract) QueryAllCars(ctx contractapi.TransactionContextInterface
 			return nil, err
 		}
 
-		car := new(Car)
-		_ = json.Unmarshal(queryResponse.Value, car)
+		queryResult, err := queryResult(queryResponse.Key, queryResponse.Value)
+
+		if err != nil {
+			return nil, err
+		}
 
-		queryResult := QueryResult{Key: queryResponse.Key, Record: car}
 		results = append(results, queryResult)
 	}
 
 	return results, nil
 }
 
-// ChangeCarOwner updates the owner field of car with given id in world state
-func (s *SmartContract) ChangeCarOwner(ctx contractapi.TransactionContextInterface, carNumber string, newOwner string) error {
-	car, err := s.QueryCar(ctx, carNumber)
+// QueryCars returns a page of cars matching the given make, model, colour and
+// owner using a CouchDB rich query. Empty criteria match any value. The
+// bookmark returned with a page is passed back in to fetch the next one.
+func (s *SmartContract) QueryCars(ctx contractapi.TransactionContextInterface, make string, model string, colour string, owner string, pageSize int32, bookmark string) (*PaginatedQueryResult, error) {
+	if pageSize <= 0 {
+		return nil, newError(ErrInvalidArgument, "page size must be greater than zero")
+	}
+
+	selector := map[string]interface{}{"docType": docTypeCar}
+	criteria := map[string]string{"make": make, "model": model, "colour": colour, "owner": owner}
+	for field, value := range criteria {
+		if value != "" {
+			selector[field] = value
+		}
+	}
+
+	queryString, err := json.Marshal(map[string]interface{}{"selector": selector})
 
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("Failed to build query. %s", err.Error())
+	}
+
+	resultsIterator, metadata, err := ctx.GetStub().GetQueryResultWithPagination(string(queryString), pageSize, bookmark)
+
+	if err != nil {
+		return nil, err
 	}
+	defer resultsIterator.Close()
+
+	results := []QueryResult{}
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+
+		if err != nil {
+			return nil, err
+		}
+
+		queryResult, err := queryResult(queryResponse.Key, queryResponse.Value)
 
-	car.Owner = newOwner
+		if err != nil {
+			return nil, err
+		}
+
+		results = append(results, queryResult)
+	}
 
-	carAsBytes, _ := json.Marshal(car)
+	return &PaginatedQueryResult{
+		Records:             results,
+		FetchedRecordsCount: metadata.FetchedRecordsCount,
+		Bookmark:            metadata.Bookmark,
+	}, nil
+}
+
+// checkIdentity runs before every transaction of both contracts. It rejects
+// clients whose identity cannot be read, which the contract API passes on as
+// a nil identity rather than failing the transaction, and identities without
+// an id or MSP
+func checkIdentity(ctx contractapi.TransactionContextInterface) error {
+	identity := ctx.GetClientIdentity()
+
+	if identity == nil {
+		return newError(ErrForbidden, "the client identity could not be read")
+	}
+
+	id, err := identity.GetID()
+
+	if err != nil || id == "" {
+		return newError(ErrForbidden, "the client identity has no id")
+	}
+
+	mspID, err := identity.GetMSPID()
+
+	if err != nil || mspID == "" {
+		return newError(ErrForbidden, "the client identity has no MSP")
+	}
+
+	return nil
+}
+
+// newChaincode creates the chaincode holding the car and dealer contracts.
+// Transactions are namespaced CarContract: and DealerContract:, with
+// CarContract the default for calls without a namespace
+func newChaincode() (*contractapi.ContractChaincode, error) {
+	carContract := new(SmartContract)
+	carContract.Name = "CarContract"
+	carContract.Info = metadata.InfoMetadata{
+		Description: errorCodesDescription() + "\n\n" + eventTypesDescription(),
+	}
+	carContract.BeforeTransaction = checkIdentity
+
+	dealerContract := new(DealerContract)
+	dealerContract.Name = "DealerContract"
+	dealerContract.Info = metadata.InfoMetadata{
+		Description: errorCodesDescription(),
+	}
+	dealerContract.BeforeTransaction = checkIdentity
 
-	return ctx.GetStub().PutState(carNumber, carAsBytes)
+	return contractapi.NewChaincode(carContract, dealerContract)
 }
 
 func main() {
 
-	chaincode, err := contractapi.NewChaincode(new(SmartContract))
+	chaincode, err := newChaincode()
 
 	if err != nil {
 		fmt.Printf("Error create fabcar chaincode: %s", err.Error())
@@ -0,0 +1,272 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+)
+
+// createCar adds a car owned by alice and fails the test if that errors
+func createCar(t *testing.T, ctx *fakeContext, carNumber string, vin string) {
+	t.Helper()
+	s := new(SmartContract)
+	err := s.CreateCar(ctx.as(alice), carNumber, "Toyota", "Prius", "blue", "Tomoko", vin)
+	assertNoError(t, err)
+}
+
+func TestNewChaincode(t *testing.T) {
+	chaincode, err := newChaincode()
+	assertNoError(t, err)
+
+	stub := shimtest.NewMockStub("fabcar", chaincode)
+	response := stub.MockInvoke("tx1", [][]byte{[]byte("org.hyperledger.fabric:GetMetadata")})
+
+	if response.Status != shim.OK {
+		t.Fatalf("failed to read metadata: %s", response.Message)
+	}
+
+	var contractMetadata struct {
+		Contracts map[string]json.RawMessage `json:"contracts"`
+	}
+	assertNoError(t, json.Unmarshal(response.Payload, &contractMetadata))
+
+	for _, name := range []string{"CarContract", "DealerContract"} {
+		if _, ok := contractMetadata.Contracts[name]; !ok {
+			t.Errorf("expected contract %s in the metadata", name)
+		}
+	}
+}
+
+func TestCheckIdentity(t *testing.T) {
+	ctx := newFakeContext()
+	assertNoError(t, checkIdentity(ctx.as(alice)))
+	assertCode(t, checkIdentity(ctx.as(&fakeIdentity{MSPID: "Org1MSP"})), ErrForbidden)
+	assertCode(t, checkIdentity(ctx.as(&fakeIdentity{ID: "alice"})), ErrForbidden)
+
+	// A mock stub has no creator, so the client identity cannot be read and
+	// both contracts refuse the transaction before it runs
+	chaincode, err := newChaincode()
+	assertNoError(t, err)
+
+	stub := shimtest.NewMockStub("fabcar", chaincode)
+
+	for _, function := range []string{"QueryAllCars", "CarContract:QueryAllCars", "DealerContract:QueryDealer"} {
+		response := stub.MockInvoke("tx1", [][]byte{[]byte(function), []byte("DEALER1")})
+
+		if response.Status == shim.OK || !strings.HasPrefix(response.Message, string(ErrForbidden)) {
+			t.Errorf("expected %s to be forbidden, got %d %s", function, response.Status, response.Message)
+		}
+	}
+}
+
+func TestInitLedger(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+
+	assertNoError(t, s.InitLedger(ctx.as(alice)))
+
+	results, err := s.QueryAllCars(ctx.as(bob))
+	assertNoError(t, err)
+
+	if len(results) != 10 {
+		t.Fatalf("expected 10 cars, got %d", len(results))
+	}
+
+	for _, result := range results {
+		if result.Record.OwnerID != "alice" || result.Record.Status != StatusRegistered || result.Record.DocType != docTypeCar {
+			t.Errorf("unexpected car %s: %+v", result.Key, result.Record)
+		}
+
+		// Every car is registered under a valid VIN
+		assertNoError(t, validateVIN(result.Record.VIN))
+
+		byVIN, err := s.QueryCarByVIN(ctx.as(bob), result.Record.VIN)
+		assertNoError(t, err)
+
+		if byVIN.Key != result.Key {
+			t.Errorf("expected VIN %s to find %s, got %s", result.Record.VIN, result.Key, byVIN.Key)
+		}
+	}
+}
+
+func TestCreateCar(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+
+	assertNoError(t, s.CreateCar(ctx.as(alice), "CAR10", "Honda", "Accord", "grey", "Ann", strings.ToLower(vin2)))
+
+	car, err := s.QueryCar(ctx.as(bob), "CAR10")
+	assertNoError(t, err)
+
+	expected := &Car{DocType: docTypeCar, Make: "Honda", Model: "Accord", Colour: "grey", Owner: "Ann", VIN: vin2, OwnerID: "alice", Status: StatusRegistered, SchemaVersion: carSchemaVersion}
+	if !reflect.DeepEqual(car, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, car)
+	}
+}
+
+func TestCreateCar_Invalid(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+	createCar(t, ctx, "CAR1", vin1)
+
+	tests := []struct {
+		name      string
+		carNumber string
+		make      string
+		vin       string
+		code      ErrorCode
+	}{
+		{"bad number", "car2", "Ford", vin2, ErrInvalidArgument},
+		{"empty make", "CAR2", " ", vin2, ErrInvalidArgument},
+		{"bad VIN", "CAR2", "Ford", "1M8GDM9AXKP04278", ErrInvalidArgument},
+		{"duplicate number", "CAR1", "Ford", vin2, ErrCarExists},
+		{"duplicate VIN", "CAR2", "Ford", vin1, ErrVINExists},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.CreateCar(ctx.as(alice), tt.carNumber, tt.make, "Mustang", "red", "Brad", tt.vin)
+			assertCode(t, err, tt.code)
+		})
+	}
+}
+
+func TestQueryCar_Missing(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+
+	_, err := s.QueryCar(ctx.as(alice), "CAR1")
+	assertCode(t, err, ErrCarNotFound)
+}
+
+func TestQueryCar_CorruptJSON(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+	ctx.putRaw(t, "CAR1", "{not json")
+
+	_, err := s.QueryCar(ctx.as(alice), "CAR1")
+	assertCode(t, err, ErrMalformedRecord)
+}
+
+func TestQueryAllCars_Range(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+
+	for _, key := range []string{"CAR0", "CAR1", "CAR10", "CAR9", "CAR98", "CAR99", "CAR100", "CAR999", "CAS0"} {
+		ctx.putRaw(t, key, `{"make":"Toyota"}`)
+	}
+
+	results, err := s.QueryAllCars(ctx.as(alice))
+	assertNoError(t, err)
+
+	// The range is end exclusive and lexical, so CAR99 is left out while
+	// CAR100 sorts inside it
+	expected := []string{"CAR0", "CAR1", "CAR10", "CAR100", "CAR9", "CAR98"}
+	if keys := sortedKeys(results); !reflect.DeepEqual(keys, expected) {
+		t.Fatalf("expected %v, got %v", expected, keys)
+	}
+}
+
+func TestQueryAllCars_Malformed(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+	createCar(t, ctx, "CAR1", vin1)
+	ctx.putRaw(t, "CAR2", "{not json")
+
+	results, err := s.QueryAllCars(ctx.as(alice))
+	assertNoError(t, err)
+
+	if len(results) != 2 || results[0].Record == nil || results[0].Error != "" {
+		t.Fatalf("unexpected results %+v", results)
+	}
+
+	if results[1].Record != nil || !strings.HasPrefix(results[1].Error, string(ErrMalformedRecord)) {
+		t.Fatalf("expected CAR2 to be reported as malformed, got %+v", results[1])
+	}
+}
+
+func TestQueryAllCars_Empty(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+
+	results, err := s.QueryAllCars(ctx.as(alice))
+	assertNoError(t, err)
+
+	if results == nil || len(results) != 0 {
+		t.Fatalf("expected an empty list, got %v", results)
+	}
+}
+
+func TestQueryCars(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+	assertNoError(t, s.InitLedger(ctx.as(alice)))
+	assertNoError(t, s.CreateCar(ctx.as(alice), "CAR10", "Toyota", "Corolla", "blue", "Ann", vin1))
+
+	page, err := s.QueryCars(ctx.as(alice), "Toyota", "", "blue", "", 1, "")
+	assertNoError(t, err)
+
+	first := page.Records.([]QueryResult)
+	if len(first) != 1 || first[0].Key != "CAR0" || page.Bookmark != "CAR0" {
+		t.Fatalf("unexpected first page %+v", page)
+	}
+
+	page, err = s.QueryCars(ctx.as(alice), "Toyota", "", "blue", "", 1, page.Bookmark)
+	assertNoError(t, err)
+
+	second := page.Records.([]QueryResult)
+	if len(second) != 1 || second[0].Key != "CAR10" {
+		t.Fatalf("unexpected second page %+v", page)
+	}
+
+	page, err = s.QueryCars(ctx.as(alice), "Toyota", "", "blue", "", 1, page.Bookmark)
+	assertNoError(t, err)
+
+	if page.FetchedRecordsCount != 0 {
+		t.Fatalf("expected an empty last page, got %+v", page)
+	}
+}
+
+func TestQueryCars_InvalidPageSize(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+
+	_, err := s.QueryCars(ctx.as(alice), "", "", "", "", 0, "")
+	assertCode(t, err, ErrInvalidArgument)
+
+	_, err = s.QueryCars(ctx.as(alice), "", "", "", "", -1, "")
+	assertCode(t, err, ErrInvalidArgument)
+}
+
+func TestQueryCars_SelectorEscaping(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+	assertNoError(t, s.InitLedger(ctx.as(alice)))
+
+	page, err := s.QueryCars(ctx.as(alice), `Toyota"},"make":{"$gt":""`, "", "", "", 10, "")
+	assertNoError(t, err)
+
+	if page.FetchedRecordsCount != 0 {
+		t.Fatalf("expected the make to be matched literally, got %+v", page)
+	}
+}
+
+func TestCarJSON(t *testing.T) {
+	car := Car{DocType: docTypeCar, Make: "Toyota", Model: "Prius", Colour: "blue", Owner: "Tomoko", SchemaVersion: carSchemaVersion}
+
+	carAsBytes, err := json.Marshal(car)
+	assertNoError(t, err)
+
+	expected := `{"docType":"car","make":"Toyota","model":"Prius","colour":"blue","owner":"Tomoko","mileage":0,"schemaVersion":1}`
+	if string(carAsBytes) != expected {
+		t.Fatalf("expected %s, got %s", expected, carAsBytes)
+	}
+}
@@ -0,0 +1,332 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// fakeStub is an in-memory stub built on shimtest.MockStub. It fills in the
+// parts the mock leaves unimplemented: key history, paginated range and rich
+// queries, transient data, private data hashes and events. Range queries
+// skip composite keys, as they do on a peer.
+type fakeStub struct {
+	*shimtest.MockStub
+	History   map[string][]*queryresult.KeyModification
+	Transient map[string][]byte
+	Events    []*pb.ChaincodeEvent
+}
+
+func newFakeStub() *fakeStub {
+	return &fakeStub{
+		MockStub: shimtest.NewMockStub("fabcar", nil),
+		History:  map[string][]*queryresult.KeyModification{},
+	}
+}
+
+func (s *fakeStub) PutState(key string, value []byte) error {
+	if err := s.MockStub.PutState(key, value); err != nil {
+		return err
+	}
+	s.History[key] = append(s.History[key], &queryresult.KeyModification{TxId: s.TxID, Value: value, Timestamp: s.TxTimestamp})
+	return nil
+}
+
+func (s *fakeStub) DelState(key string) error {
+	if err := s.MockStub.DelState(key); err != nil {
+		return err
+	}
+	s.History[key] = append(s.History[key], &queryresult.KeyModification{TxId: s.TxID, Timestamp: s.TxTimestamp, IsDelete: true})
+	return nil
+}
+
+// GetHistoryForKey returns the changes to key newest first, like the peer.
+func (s *fakeStub) GetHistoryForKey(key string) (shim.HistoryQueryIteratorInterface, error) {
+	mods := []*queryresult.KeyModification{}
+	for i := len(s.History[key]) - 1; i >= 0; i-- {
+		mods = append(mods, s.History[key][i])
+	}
+	return &historyIterator{mods: mods}, nil
+}
+
+func (s *fakeStub) GetTransient() (map[string][]byte, error) {
+	return s.Transient, nil
+}
+
+func (s *fakeStub) DelPrivateData(collection, key string) error {
+	delete(s.PvtState[collection], key)
+	return nil
+}
+
+func (s *fakeStub) GetPrivateDataHash(collection, key string) ([]byte, error) {
+	value, err := s.GetPrivateData(collection, key)
+	if err != nil || value == nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(value)
+	return hash[:], nil
+}
+
+func (s *fakeStub) SetEvent(name string, payload []byte) error {
+	s.Events = append(s.Events, &pb.ChaincodeEvent{EventName: name, Payload: payload})
+	return nil
+}
+
+// simpleKeys returns the non-composite keys in order, as a range query over
+// the whole key space would on a peer.
+func (s *fakeStub) simpleKeys() []string {
+	keys := []string{}
+	for elem := s.Keys.Front(); elem != nil; elem = elem.Next() {
+		key := elem.Value.(string)
+		if !strings.HasPrefix(key, "\x00") {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// page returns up to pageSize of keys that sort after bookmark, along with
+// the bookmark for the following page.
+func (s *fakeStub) page(keys []string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *pb.QueryResponseMetadata) {
+	kvs := []*queryresult.KV{}
+	for _, key := range keys {
+		if bookmark != "" && key <= bookmark {
+			continue
+		}
+		if int32(len(kvs)) == pageSize {
+			break
+		}
+		kvs = append(kvs, &queryresult.KV{Key: key, Value: s.State[key]})
+	}
+
+	next := ""
+	if len(kvs) > 0 {
+		next = kvs[len(kvs)-1].Key
+	}
+	return &stateIterator{kvs: kvs}, &pb.QueryResponseMetadata{FetchedRecordsCount: int32(len(kvs)), Bookmark: next}
+}
+
+// rangeKeys returns the simple keys from startKey up to but excluding
+// endKey. Empty keys leave the range open at that end
+func (s *fakeStub) rangeKeys(startKey, endKey string) []string {
+	keys := []string{}
+	for _, key := range s.simpleKeys() {
+		if (startKey == "" || key >= startKey) && (endKey == "" || key < endKey) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func (s *fakeStub) GetStateByRange(startKey, endKey string) (shim.StateQueryIteratorInterface, error) {
+	it, _ := s.page(s.rangeKeys(startKey, endKey), int32(s.Keys.Len()), "")
+	return it, nil
+}
+
+func (s *fakeStub) GetStateByRangeWithPagination(startKey, endKey string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *pb.QueryResponseMetadata, error) {
+	it, metadata := s.page(s.rangeKeys(startKey, endKey), pageSize, bookmark)
+	return it, metadata, nil
+}
+
+// GetQueryResultWithPagination supports selectors made of plain field
+// equality, which is all the contract uses.
+func (s *fakeStub) GetQueryResultWithPagination(query string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *pb.QueryResponseMetadata, error) {
+	var q struct {
+		Selector map[string]interface{} `json:"selector"`
+	}
+	if err := json.Unmarshal([]byte(query), &q); err != nil {
+		return nil, nil, err
+	}
+
+	keys := []string{}
+	for _, key := range s.simpleKeys() {
+		var doc map[string]interface{}
+		if err := json.Unmarshal(s.State[key], &doc); err != nil {
+			continue
+		}
+		match := true
+		for field, value := range q.Selector {
+			if doc[field] != value {
+				match = false
+				break
+			}
+		}
+		if match {
+			keys = append(keys, key)
+		}
+	}
+	it, metadata := s.page(keys, pageSize, bookmark)
+	return it, metadata, nil
+}
+
+type stateIterator struct {
+	kvs []*queryresult.KV
+}
+
+func (it *stateIterator) HasNext() bool { return len(it.kvs) > 0 }
+
+func (it *stateIterator) Next() (*queryresult.KV, error) {
+	if len(it.kvs) == 0 {
+		return nil, errors.New("no more results")
+	}
+	kv := it.kvs[0]
+	it.kvs = it.kvs[1:]
+	return kv, nil
+}
+
+func (it *stateIterator) Close() error { return nil }
+
+type historyIterator struct {
+	mods []*queryresult.KeyModification
+}
+
+func (it *historyIterator) HasNext() bool { return len(it.mods) > 0 }
+
+func (it *historyIterator) Next() (*queryresult.KeyModification, error) {
+	if len(it.mods) == 0 {
+		return nil, errors.New("no more results")
+	}
+	mod := it.mods[0]
+	it.mods = it.mods[1:]
+	return mod, nil
+}
+
+func (it *historyIterator) Close() error { return nil }
+
+// fakeIdentity is a client identity with a fixed ID, MSP and attributes.
+type fakeIdentity struct {
+	ID    string
+	MSPID string
+	Attrs map[string]string
+}
+
+func (id *fakeIdentity) GetID() (string, error) { return id.ID, nil }
+
+func (id *fakeIdentity) GetMSPID() (string, error) { return id.MSPID, nil }
+
+func (id *fakeIdentity) GetAttributeValue(attrName string) (string, bool, error) {
+	value, found := id.Attrs[attrName]
+	return value, found, nil
+}
+
+func (id *fakeIdentity) AssertAttributeValue(attrName, attrValue string) error {
+	value, found := id.Attrs[attrName]
+	if !found || value != attrValue {
+		return fmt.Errorf("attribute '%s' does not equal '%s'", attrName, attrValue)
+	}
+	return nil
+}
+
+func (id *fakeIdentity) GetX509Certificate() (*x509.Certificate, error) { return nil, nil }
+
+var (
+	alice  = &fakeIdentity{ID: "alice", MSPID: "Org1MSP"}
+	bob    = &fakeIdentity{ID: "bob", MSPID: "Org2MSP"}
+	carol  = &fakeIdentity{ID: "carol", MSPID: "Org3MSP"}
+	garage = &fakeIdentity{ID: "garage", MSPID: "Org1MSP", Attrs: map[string]string{"garage": "true"}}
+	admin  = &fakeIdentity{ID: "admin", MSPID: "Org1MSP", Attrs: map[string]string{"fabcar.admin": "true"}}
+)
+
+// fakeContext implements contractapi.TransactionContextInterface over a
+// fakeStub. Each call to as starts a new transaction as the given client.
+type fakeContext struct {
+	stub     *fakeStub
+	identity cid.ClientIdentity
+	txCount  int
+}
+
+func newFakeContext() *fakeContext {
+	return &fakeContext{stub: newFakeStub(), identity: alice}
+}
+
+func (ctx *fakeContext) GetStub() shim.ChaincodeStubInterface { return ctx.stub }
+
+func (ctx *fakeContext) GetClientIdentity() cid.ClientIdentity { return ctx.identity }
+
+// as starts a new transaction submitted by id and returns the context.
+func (ctx *fakeContext) as(id cid.ClientIdentity) *fakeContext {
+	ctx.txCount++
+	ctx.stub.MockTransactionStart(fmt.Sprintf("tx%d", ctx.txCount))
+	ctx.stub.Transient = nil
+	ctx.identity = id
+	return ctx
+}
+
+// putRaw writes value directly to world state, bypassing the contract.
+func (ctx *fakeContext) putRaw(t *testing.T, key string, value string) {
+	ctx.as(ctx.identity)
+	if err := ctx.stub.PutState(key, []byte(value)); err != nil {
+		t.Fatalf("failed to put %s: %s", key, err)
+	}
+}
+
+// lastEvent returns the most recent event the contract emitted.
+func (ctx *fakeContext) lastEvent(t *testing.T) *pb.ChaincodeEvent {
+	if len(ctx.stub.Events) == 0 {
+		t.Fatal("expected an event")
+	}
+	return ctx.stub.Events[len(ctx.stub.Events)-1]
+}
+
+// assertCode fails the test unless err is a ContractError with the code.
+func assertCode(t *testing.T, err error, code ErrorCode) {
+	t.Helper()
+	ce, ok := err.(*ContractError)
+	if !ok {
+		t.Fatalf("expected %s error, got %v", code, err)
+	}
+	if ce.Code != code {
+		t.Fatalf("expected %s error, got %s", code, ce)
+	}
+}
+
+func assertNoError(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+// sortedKeys returns the keys of the query results in order.
+func sortedKeys(results []QueryResult) []string {
+	keys := []string{}
+	for _, r := range results {
+		keys = append(keys, r.Key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// testVIN returns a valid VIN with the given serial number
+func testVIN(serial int) string {
+	vin := []byte(fmt.Sprintf("1HGCM82630A%06d", serial))
+	sum := 0
+	for i, c := range vin {
+		value, _ := vinValue(c)
+		sum += value * vinWeights[i]
+	}
+	vin[8] = "0123456789X"[sum%11]
+	return string(vin)
+}
+
+// Valid VINs used across the tests.
+const (
+	vin1 = "1M8GDM9AXKP042788"
+	vin2 = "1HGCM82633A004352"
+	vin3 = "11111111111111111"
+)
@@ -2,4 +2,8 @@ module github.com/hyperledger/fabric-samples/chaincode/fabcar/go
 
 go 1.13
 
-require github.com/hyperledger/fabric-contract-api-go v0.0.0-20191118113407-4c6ff12b4f96
+require (
+	github.com/hyperledger/fabric-chaincode-go v0.0.0-20191108205148-17c4b2760b56
+	github.com/hyperledger/fabric-contract-api-go v0.0.0-20191118113407-4c6ff12b4f96
+	github.com/hyperledger/fabric-protos-go v0.0.0-20191114160927-6bee4929a99f
+)
@@ -0,0 +1,135 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// HistoryQueryResult structure used for returning one change to a car
+type HistoryQueryResult struct {
+	TxID      string    `json:"txId"`
+	Timestamp time.Time `json:"timestamp"`
+	Record    *Car      `json:"record,omitempty" metadata:",optional"`
+	IsDelete  bool      `json:"isDelete"`
+}
+
+// OwnershipRecord structure used for returning one transfer of title
+type OwnershipRecord struct {
+	TxID            string    `json:"txId"`
+	Timestamp       time.Time `json:"timestamp"`
+	Owner           string    `json:"owner"`
+	OwnerID         string    `json:"ownerId"`
+	PreviousOwner   string    `json:"previousOwner"`
+	PreviousOwnerID string    `json:"previousOwnerId"`
+}
+
+// GetCarHistory returns every change made to the car with given id, oldest
+// first, with records in older layouts upgraded to the current one. Changes
+// are kept in the order they were committed; the timestamps are chosen by the
+// submitting clients, so they are reported but never used to order the
+// history
+func (s *SmartContract) GetCarHistory(ctx contractapi.TransactionContextInterface, carNumber string) ([]HistoryQueryResult, error) {
+	resultsIterator, err := ctx.GetStub().GetHistoryForKey(carNumber)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read history from world state. %s", err.Error())
+	}
+	defer resultsIterator.Close()
+
+	results := []HistoryQueryResult{}
+
+	for resultsIterator.HasNext() {
+		modification, err := resultsIterator.Next()
+
+		if err != nil {
+			return nil, err
+		}
+
+		result := HistoryQueryResult{
+			TxID:     modification.TxId,
+			IsDelete: modification.IsDelete,
+		}
+
+		if ts := modification.Timestamp; ts != nil {
+			result.Timestamp = time.Unix(ts.Seconds, int64(ts.Nanos)).UTC()
+		}
+
+		if !modification.IsDelete {
+			car, err := decodeCar(carNumber, modification.Value)
+
+			if err != nil {
+				return nil, err
+			}
+
+			result.Record = car
+		}
+
+		results = append(results, result)
+	}
+
+	if len(results) == 0 {
+		return nil, newError(ErrCarNotFound, "%s does not exist", carNumber)
+	}
+
+	// The peer returns the history newest first
+	for i, j := 0, len(results)-1; i < j; i, j = i+1, j-1 {
+		results[i], results[j] = results[j], results[i]
+	}
+
+	return results, nil
+}
+
+// sameOwner returns true when the car is held by the given owner. Owners are
+// told apart by their client identity, since display names need not be
+// unique; records stored before owners were identified only carry the name
+func sameOwner(owner string, ownerID string, car *Car) bool {
+	if ownerID == "" || car.OwnerID == "" {
+		return car.Owner == owner
+	}
+
+	return car.OwnerID == ownerID
+}
+
+// GetOwnershipChain returns the owners of the car with given id in the order
+// they acquired it, giving a chain of title
+func (s *SmartContract) GetOwnershipChain(ctx contractapi.TransactionContextInterface, carNumber string) ([]OwnershipRecord, error) {
+	history, err := s.GetCarHistory(ctx, carNumber)
+
+	if err != nil {
+		return nil, err
+	}
+
+	chain := []OwnershipRecord{}
+	previousOwner, previousOwnerID := "", ""
+
+	for _, entry := range history {
+		if entry.IsDelete {
+			previousOwner, previousOwnerID = "", ""
+			continue
+		}
+
+		if len(chain) > 0 && sameOwner(previousOwner, previousOwnerID, entry.Record) {
+			// The owner may have been identified since, see AssignOwner
+			previousOwnerID = entry.Record.OwnerID
+			continue
+		}
+
+		chain = append(chain, OwnershipRecord{
+			TxID:            entry.TxID,
+			Timestamp:       entry.Timestamp,
+			Owner:           entry.Record.Owner,
+			OwnerID:         entry.Record.OwnerID,
+			PreviousOwner:   previousOwner,
+			PreviousOwnerID: previousOwnerID,
+		})
+		previousOwner, previousOwnerID = entry.Record.Owner, entry.Record.OwnerID
+	}
+
+	return chain, nil
+}
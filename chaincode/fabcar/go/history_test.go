@@ -0,0 +1,143 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetCarHistory(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+	createCar(t, ctx, "CAR1", vin1)
+	assertNoError(t, s.ListForSale(ctx.as(alice), "CAR1"))
+	assertNoError(t, s.DeleteCar(ctx.as(alice), "CAR1"))
+	deleteTxID := ctx.stub.TxID
+
+	history, err := s.GetCarHistory(ctx.as(alice), "CAR1")
+	assertNoError(t, err)
+
+	if len(history) != 3 {
+		t.Fatalf("expected 3 changes, got %d", len(history))
+	}
+
+	if history[0].Record.Status != StatusRegistered || history[1].Record.Status != StatusForSale {
+		t.Fatalf("unexpected history %+v", history)
+	}
+
+	if !history[2].IsDelete || history[2].Record != nil || history[2].TxID != deleteTxID {
+		t.Fatalf("expected the last change to be the delete, got %+v", history[2])
+	}
+}
+
+func TestGetCarHistory_BackdatedTimestamp(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+	createCar(t, ctx, "CAR1", vin1)
+
+	// A client backdates the timestamp of a later transaction
+	ctx.as(alice)
+	backdated := *ctx.stub.TxTimestamp
+	backdated.Seconds -= 3600
+	ctx.stub.TxTimestamp = &backdated
+	assertNoError(t, s.ListForSale(ctx, "CAR1"))
+
+	history, err := s.GetCarHistory(ctx.as(alice), "CAR1")
+	assertNoError(t, err)
+
+	if len(history) != 2 || history[0].Record.Status != StatusRegistered || history[1].Record.Status != StatusForSale {
+		t.Fatalf("expected the history in commit order, got %+v", history)
+	}
+}
+
+func TestGetCarHistory_Missing(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+
+	_, err := s.GetCarHistory(ctx.as(alice), "CAR1")
+	assertCode(t, err, ErrCarNotFound)
+}
+
+func TestGetCarHistory_Legacy(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+	ctx.putRaw(t, "CAR1", legacyCar)
+
+	history, err := s.GetCarHistory(ctx.as(alice), "CAR1")
+	assertNoError(t, err)
+
+	car := history[0].Record
+	if car.DocType != docTypeCar || car.Status != StatusRegistered || car.SchemaVersion != carSchemaVersion {
+		t.Fatalf("expected the legacy record to be upgraded, got %+v", car)
+	}
+}
+
+func TestGetCarHistory_CorruptJSON(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+	ctx.putRaw(t, "CAR1", "[")
+
+	_, err := s.GetCarHistory(ctx.as(alice), "CAR1")
+	assertCode(t, err, ErrMalformedRecord)
+}
+
+func TestGetOwnershipChain(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+	createCar(t, ctx, "CAR1", vin1)
+	offerCar(t, ctx, "CAR1", 100)
+	assertNoError(t, s.AcceptCarTransfer(ctx.as(bob), "CAR1"))
+
+	chain, err := s.GetOwnershipChain(ctx.as(alice), "CAR1")
+	assertNoError(t, err)
+
+	owners := [][2]string{}
+	for _, record := range chain {
+		owners = append(owners, [2]string{record.PreviousOwner, record.Owner})
+	}
+
+	expected := [][2]string{{"", "Tomoko"}, {"Tomoko", "Bob"}}
+	if !reflect.DeepEqual(owners, expected) {
+		t.Fatalf("expected %v, got %v", expected, owners)
+	}
+
+	if chain[1].OwnerID != "bob" || chain[1].PreviousOwnerID != "alice" {
+		t.Fatalf("unexpected owner identities %+v", chain[1])
+	}
+}
+
+func TestGetOwnershipChain_SameName(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+	createCar(t, ctx, "CAR1", vin1)
+	assertNoError(t, s.ListForSale(ctx.as(alice), "CAR1"))
+	assertNoError(t, s.ChangeCarOwner(ctx.as(alice), "CAR1", "Tomoko", "bob", 0))
+	assertNoError(t, s.AcceptCarTransfer(ctx.as(bob), "CAR1"))
+
+	chain, err := s.GetOwnershipChain(ctx.as(alice), "CAR1")
+	assertNoError(t, err)
+
+	if len(chain) != 2 || chain[1].OwnerID != "bob" || chain[1].PreviousOwnerID != "alice" {
+		t.Fatalf("expected a transfer between two owners named Tomoko, got %+v", chain)
+	}
+}
+
+func TestGetOwnershipChain_Legacy(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+	ctx.putRaw(t, "CAR1", legacyCar)
+	assertNoError(t, s.AssignOwner(ctx.as(admin), "CAR1", "alice"))
+	offerCar(t, ctx, "CAR1", 0)
+	assertNoError(t, s.AcceptCarTransfer(ctx.as(bob), "CAR1"))
+
+	chain, err := s.GetOwnershipChain(ctx.as(alice), "CAR1")
+	assertNoError(t, err)
+
+	// Identifying the legacy owner does not count as a transfer of title
+	if len(chain) != 2 || chain[0].Owner != "Tomoko" || chain[1].Owner != "Bob" || chain[1].PreviousOwnerID != "alice" {
+		t.Fatalf("unexpected chain %+v", chain)
+	}
+}
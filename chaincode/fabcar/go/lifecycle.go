@@ -0,0 +1,125 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package main
+
+import (
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Lifecycle states of a car
+const (
+	StatusRegistered = "Registered"
+	StatusForSale    = "ForSale"
+	StatusSold       = "Sold"
+	StatusStolen     = "Stolen"
+	StatusScrapped   = "Scrapped"
+)
+
+// statusTransitions lists the states a car may move to from each state.
+// Scrapped is final
+var statusTransitions = map[string][]string{
+	StatusRegistered: {StatusForSale, StatusStolen, StatusScrapped},
+	StatusForSale:    {StatusRegistered, StatusSold, StatusStolen, StatusScrapped},
+	StatusSold:       {StatusForSale, StatusStolen, StatusScrapped},
+	StatusStolen:     {StatusRegistered, StatusScrapped},
+	StatusScrapped:   {},
+}
+
+// CurrentStatus returns the lifecycle state of the car. Cars stored before
+// states were introduced are Registered
+func (c *Car) CurrentStatus() string {
+	if c.Status == "" {
+		return StatusRegistered
+	}
+
+	return c.Status
+}
+
+// transition moves the car to the given state if the state machine allows it
+func (c *Car) transition(carNumber string, status string) error {
+	for _, allowed := range statusTransitions[c.CurrentStatus()] {
+		if allowed == status {
+			c.Status = status
+			return nil
+		}
+	}
+
+	return newError(ErrInvalidState, "%s cannot move from %s to %s", carNumber, c.CurrentStatus(), status)
+}
+
+// assertTransferable returns an error if the car may not change hands
+func (c *Car) assertTransferable(carNumber string) error {
+	switch c.CurrentStatus() {
+	case StatusStolen, StatusScrapped:
+		return newError(ErrInvalidState, "%s is %s and cannot be transferred", carNumber, c.CurrentStatus())
+	}
+
+	return nil
+}
+
+// setStatus moves the car with given id to the given state on behalf of its
+// owner. If from is not empty the car must currently be in that state
+func (s *SmartContract) setStatus(ctx contractapi.TransactionContextInterface, carNumber string, from string, status string) error {
+	car, err := s.QueryCar(ctx, carNumber)
+
+	if err != nil {
+		return err
+	}
+
+	if err := assertOwner(ctx, carNumber, car); err != nil {
+		return err
+	}
+
+	if from != "" && car.CurrentStatus() != from {
+		return newError(ErrInvalidState, "%s is %s, not %s", carNumber, car.CurrentStatus(), from)
+	}
+
+	if err := car.transition(carNumber, status); err != nil {
+		return err
+	}
+
+	return s.putCar(ctx, carNumber, car)
+}
+
+// ListForSale marks the car with given id as for sale
+func (s *SmartContract) ListForSale(ctx contractapi.TransactionContextInterface, carNumber string) error {
+	return s.setStatus(ctx, carNumber, "", StatusForSale)
+}
+
+// WithdrawFromSale takes the car with given id off sale, returning it to the
+// registered state. Any pending transfer of the car is cancelled
+func (s *SmartContract) WithdrawFromSale(ctx contractapi.TransactionContextInterface, carNumber string) error {
+	if err := s.setStatus(ctx, carNumber, StatusForSale, StatusRegistered); err != nil {
+		return err
+	}
+
+	return s.clearTransfer(ctx, carNumber)
+}
+
+// ReportStolen marks the car with given id as stolen. Stolen cars cannot be
+// transferred until they are recovered, so any pending transfer of the car is
+// cancelled
+func (s *SmartContract) ReportStolen(ctx contractapi.TransactionContextInterface, carNumber string) error {
+	if err := s.setStatus(ctx, carNumber, "", StatusStolen); err != nil {
+		return err
+	}
+
+	return s.clearTransfer(ctx, carNumber)
+}
+
+// Recover returns a stolen car with given id to the registered state
+func (s *SmartContract) Recover(ctx contractapi.TransactionContextInterface, carNumber string) error {
+	return s.setStatus(ctx, carNumber, StatusStolen, StatusRegistered)
+}
+
+// Scrap marks the car with given id as scrapped and cancels any pending
+// transfer of it. This cannot be undone
+func (s *SmartContract) Scrap(ctx contractapi.TransactionContextInterface, carNumber string) error {
+	if err := s.setStatus(ctx, carNumber, "", StatusScrapped); err != nil {
+		return err
+	}
+
+	return s.clearTransfer(ctx, carNumber)
+}
@@ -0,0 +1,144 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package main
+
+import (
+	"testing"
+)
+
+func TestCarTransition(t *testing.T) {
+	tests := []struct {
+		from    string
+		to      string
+		allowed bool
+	}{
+		{"", StatusForSale, true},
+		{StatusRegistered, StatusSold, false},
+		{StatusForSale, StatusSold, true},
+		{StatusForSale, StatusRegistered, true},
+		{StatusSold, StatusForSale, true},
+		{StatusStolen, StatusForSale, false},
+		{StatusStolen, StatusRegistered, true},
+		{StatusScrapped, StatusRegistered, false},
+	}
+
+	for _, tt := range tests {
+		car := Car{Status: tt.from}
+		err := car.transition("CAR1", tt.to)
+
+		if tt.allowed {
+			assertNoError(t, err)
+
+			if car.Status != tt.to {
+				t.Errorf("expected %s, got %s", tt.to, car.Status)
+			}
+		} else {
+			assertCode(t, err, ErrInvalidState)
+		}
+	}
+}
+
+func TestLifecycle(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+	createCar(t, ctx, "CAR1", vin1)
+
+	assertCode(t, s.ListForSale(ctx.as(bob), "CAR1"), ErrForbidden)
+	assertCode(t, s.Recover(ctx.as(alice), "CAR1"), ErrInvalidState)
+	assertCode(t, s.Scrap(ctx.as(alice), "CAR2"), ErrCarNotFound)
+
+	steps := []struct {
+		apply  func(*fakeContext, string) error
+		status string
+	}{
+		{func(ctx *fakeContext, n string) error { return s.ListForSale(ctx, n) }, StatusForSale},
+		{func(ctx *fakeContext, n string) error { return s.ReportStolen(ctx, n) }, StatusStolen},
+		{func(ctx *fakeContext, n string) error { return s.Recover(ctx, n) }, StatusRegistered},
+		{func(ctx *fakeContext, n string) error { return s.Scrap(ctx, n) }, StatusScrapped},
+	}
+
+	for _, step := range steps {
+		assertNoError(t, step.apply(ctx.as(alice), "CAR1"))
+
+		car, err := s.QueryCar(ctx.as(alice), "CAR1")
+		assertNoError(t, err)
+
+		if car.Status != step.status {
+			t.Fatalf("expected %s, got %s", step.status, car.Status)
+		}
+	}
+
+	assertCode(t, s.ListForSale(ctx.as(alice), "CAR1"), ErrInvalidState)
+}
+
+func TestWithdrawFromSale(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+	createCar(t, ctx, "CAR1", vin1)
+
+	assertCode(t, s.WithdrawFromSale(ctx.as(alice), "CAR1"), ErrInvalidState)
+
+	offerCar(t, ctx, "CAR1", 100)
+	assertCode(t, s.WithdrawFromSale(ctx.as(bob), "CAR1"), ErrForbidden)
+	assertNoError(t, s.WithdrawFromSale(ctx.as(alice), "CAR1"))
+
+	car, err := s.QueryCar(ctx.as(alice), "CAR1")
+	assertNoError(t, err)
+
+	if car.Status != StatusRegistered {
+		t.Fatalf("expected %s, got %s", StatusRegistered, car.Status)
+	}
+
+	// The pending offer went with the listing
+	_, err = s.QueryCarTransfer(ctx.as(bob), "CAR1")
+	assertCode(t, err, ErrTransferNotFound)
+
+	// A car that is for sale is not stolen, so it cannot be recovered
+	assertNoError(t, s.ListForSale(ctx.as(alice), "CAR1"))
+	assertCode(t, s.Recover(ctx.as(alice), "CAR1"), ErrInvalidState)
+}
+
+func TestReportStolen_CancelsTransfer(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+	createCar(t, ctx, "CAR1", vin1)
+	assertNoError(t, offerCarWithSale(ctx, "CAR1", `{"price":12500,"buyerContact":"bob@example.com","buyerMSP":"Org2MSP"}`))
+
+	assertNoError(t, s.ReportStolen(ctx.as(alice), "CAR1"))
+	assertNoError(t, s.Recover(ctx.as(alice), "CAR1"))
+	assertNoError(t, s.ListForSale(ctx.as(alice), "CAR1"))
+
+	// The offer made before the theft cannot be accepted once the car is
+	// listed again
+	assertCode(t, s.AcceptCarTransfer(ctx.as(bob), "CAR1"), ErrTransferNotFound)
+
+	if len(ctx.stub.PvtState[saleCollection]) != 0 {
+		t.Fatalf("expected no sale data, got %v", ctx.stub.PvtState[saleCollection])
+	}
+}
+
+func TestScrap_CancelsTransfer(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+	createCar(t, ctx, "CAR1", vin1)
+	assertNoError(t, offerCarWithSale(ctx, "CAR1", `{"price":12500,"buyerContact":"bob@example.com","buyerMSP":"Org2MSP"}`))
+
+	assertNoError(t, s.Scrap(ctx.as(alice), "CAR1"))
+
+	_, err := s.QueryCarTransfer(ctx.as(bob), "CAR1")
+	assertCode(t, err, ErrTransferNotFound)
+
+	if len(ctx.stub.PvtState[saleCollection]) != 0 {
+		t.Fatalf("expected no sale data, got %v", ctx.stub.PvtState[saleCollection])
+	}
+}
+
+func TestLifecycle_LegacyCar(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+	ctx.putRaw(t, "CAR1", `{"make":"Toyota","model":"Prius","colour":"blue","owner":"Tomoko","ownerId":"alice"}`)
+
+	assertNoError(t, s.ListForSale(ctx.as(alice), "CAR1"))
+}
@@ -0,0 +1,148 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// carSchemaVersion is the version of the car record layout written by this
+// chaincode. Bump it and register a migration when the layout changes
+const carSchemaVersion = 1
+
+// carMigrations upgrades a car record from the keyed schema version to the
+// next one
+var carMigrations = map[int]func(*Car){
+	// Version 0 records were written before cars had a document type and
+	// lifecycle states
+	0: func(c *Car) {
+		c.DocType = docTypeCar
+
+		if c.Status == "" {
+			c.Status = StatusRegistered
+		}
+	},
+}
+
+// MigrationResult structure used for reporting one page of MigrateAll. Each
+// malformed record is reported with the reason it could not be read
+type MigrationResult struct {
+	Migrated  []string          `json:"migrated"`
+	Malformed map[string]string `json:"malformed"`
+	Bookmark  string            `json:"bookmark"`
+}
+
+// upgrade applies the registered migrations to bring the car up to the
+// current schema version
+func (c *Car) upgrade(carNumber string) error {
+	if c.SchemaVersion > carSchemaVersion {
+		return newError(ErrMalformedRecord, "%s has schema version %d, newer than the supported %d", carNumber, c.SchemaVersion, carSchemaVersion)
+	}
+
+	for c.SchemaVersion < carSchemaVersion {
+		migrate, ok := carMigrations[c.SchemaVersion]
+
+		if !ok {
+			return newError(ErrMalformedRecord, "%s has schema version %d, which cannot be migrated", carNumber, c.SchemaVersion)
+		}
+
+		migrate(c)
+		c.SchemaVersion++
+	}
+
+	return nil
+}
+
+// decodeCar reads a car record from world state, upgrading it to the current
+// schema version. Records that are not valid cars are reported as malformed
+func decodeCar(carNumber string, carAsBytes []byte) (*Car, error) {
+	car := new(Car)
+
+	if err := json.Unmarshal(carAsBytes, car); err != nil {
+		return nil, newError(ErrMalformedRecord, "%s is not a valid car record. %s", carNumber, err.Error())
+	}
+
+	if car.DocType != "" && car.DocType != docTypeCar {
+		return nil, newError(ErrMalformedRecord, "%s is a %s record, not a car", carNumber, car.DocType)
+	}
+
+	if err := car.upgrade(carNumber); err != nil {
+		return nil, err
+	}
+
+	return car, nil
+}
+
+// MigrateAll upgrades up to pageSize stored cars to the current schema
+// version, starting at the bookmark key. Pass the returned bookmark back in
+// to continue; it is empty once every car has been visited. Only a registry
+// admin may migrate cars
+func (s *SmartContract) MigrateAll(ctx contractapi.TransactionContextInterface, pageSize int32, bookmark string) (*MigrationResult, error) {
+	if !isRegistryAdmin(ctx) {
+		return nil, newError(ErrForbidden, "only a registry admin may migrate cars")
+	}
+
+	if pageSize <= 0 {
+		return nil, newError(ErrInvalidArgument, "page size must be greater than zero")
+	}
+
+	// Paginated queries are only allowed in read only transactions, so the
+	// page is cut from a plain range query
+	resultsIterator, err := ctx.GetStub().GetStateByRange(bookmark, "")
+
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	result := &MigrationResult{
+		Migrated:  []string{},
+		Malformed: map[string]string{},
+	}
+
+	for visited := int32(0); resultsIterator.HasNext(); visited++ {
+		queryResponse, err := resultsIterator.Next()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if visited == pageSize {
+			result.Bookmark = queryResponse.Key
+			break
+		}
+
+		car, err := decodeCar(queryResponse.Key, queryResponse.Value)
+
+		if err != nil {
+			if ce, ok := err.(*ContractError); ok {
+				result.Malformed[queryResponse.Key] = ce.Message
+				continue
+			}
+
+			return nil, err
+		}
+
+		// Only records stored below the current version are rewritten
+		var stored struct {
+			SchemaVersion int `json:"schemaVersion"`
+		}
+		_ = json.Unmarshal(queryResponse.Value, &stored)
+
+		if stored.SchemaVersion == carSchemaVersion {
+			continue
+		}
+
+		if err := s.putCar(ctx, queryResponse.Key, car); err != nil {
+			return nil, err
+		}
+
+		result.Migrated = append(result.Migrated, queryResponse.Key)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,117 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+const legacyCar = `{"make":"Toyota","model":"Prius","colour":"blue","owner":"Tomoko"}`
+
+func TestQueryCar_Upgrade(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+	ctx.putRaw(t, "CAR1", legacyCar)
+
+	car, err := s.QueryCar(ctx.as(alice), "CAR1")
+	assertNoError(t, err)
+
+	expected := &Car{DocType: docTypeCar, Make: "Toyota", Model: "Prius", Colour: "blue", Owner: "Tomoko", Status: StatusRegistered, SchemaVersion: carSchemaVersion}
+	if !reflect.DeepEqual(car, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, car)
+	}
+
+	// Reading does not write the upgraded record back
+	if string(ctx.stub.State["CAR1"]) != legacyCar {
+		t.Fatalf("expected the stored record to be unchanged, got %s", ctx.stub.State["CAR1"])
+	}
+}
+
+func TestQueryCar_Malformed(t *testing.T) {
+	tests := []struct {
+		name   string
+		record string
+	}{
+		{"not JSON", "CAR1"},
+		{"wrong type", `{"make":42}`},
+		{"not a car", `{"docType":"dealer"}`},
+		{"future version", `{"docType":"car","schemaVersion":99}`},
+		{"negative version", `{"docType":"car","schemaVersion":-1}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := newFakeContext()
+			s := new(SmartContract)
+			ctx.putRaw(t, "CAR1", tt.record)
+
+			_, err := s.QueryCar(ctx.as(alice), "CAR1")
+			assertCode(t, err, ErrMalformedRecord)
+		})
+	}
+}
+
+func TestMigrateAll(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+	createCar(t, ctx, "CAR1", vin1)
+	ctx.putRaw(t, "CAR2", legacyCar)
+	ctx.putRaw(t, "CAR3", "{")
+	ctx.putRaw(t, "CAR4", legacyCar)
+	ctx.putRaw(t, "CAR5", legacyCar)
+
+	_, err := s.MigrateAll(ctx.as(alice), 10, "")
+	assertCode(t, err, ErrForbidden)
+
+	_, err = s.MigrateAll(ctx.as(admin), 0, "")
+	assertCode(t, err, ErrInvalidArgument)
+
+	result, err := s.MigrateAll(ctx.as(admin), 4, "")
+	assertNoError(t, err)
+
+	if !reflect.DeepEqual(result.Migrated, []string{"CAR2", "CAR4"}) || len(result.Malformed) != 1 || result.Malformed["CAR3"] == "" || result.Bookmark != "CAR5" {
+		t.Fatalf("unexpected first page %+v", result)
+	}
+
+	result, err = s.MigrateAll(ctx.as(admin), 4, result.Bookmark)
+	assertNoError(t, err)
+
+	if !reflect.DeepEqual(result.Migrated, []string{"CAR5"}) || len(result.Malformed) != 0 || result.Bookmark != "" {
+		t.Fatalf("unexpected last page %+v", result)
+	}
+
+	for _, carNumber := range []string{"CAR2", "CAR4", "CAR5"} {
+		stored, err := decodeCar(carNumber, ctx.stub.State[carNumber])
+		assertNoError(t, err)
+
+		if stored.DocType != docTypeCar || stored.Status != StatusRegistered {
+			t.Errorf("expected %s to be migrated, got %+v", carNumber, stored)
+		}
+	}
+
+	result, err = s.MigrateAll(ctx.as(admin), 10, "")
+	assertNoError(t, err)
+
+	if len(result.Migrated) != 0 {
+		t.Fatalf("expected nothing left to migrate, got %+v", result)
+	}
+}
+
+func TestRestoreCar_Upgrade(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+	key, _ := ctx.stub.CreateCompositeKey(archiveIndex, []string{"CAR1"})
+	ctx.putRaw(t, key, `{"carNumber":"CAR1","record":`+legacyCar+`}`)
+
+	assertNoError(t, s.RestoreCar(ctx.as(admin), "CAR1"))
+
+	car, err := decodeCar("CAR1", ctx.stub.State["CAR1"])
+	assertNoError(t, err)
+
+	if car.DocType != docTypeCar || car.SchemaVersion != carSchemaVersion {
+		t.Fatalf("expected the restored car to be upgraded, got %+v", car)
+	}
+}
@@ -0,0 +1,308 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// transferIndex is the composite key prefix for pending transfers
+const transferIndex = "transfer"
+
+// TransferOffer describes a handover the current owner has offered and the
+// new owner has yet to accept
+type TransferOffer struct {
+	CarNumber string `json:"carNumber"`
+	FromID    string `json:"fromId"`
+	ToID      string `json:"toId"`
+	ToName    string `json:"toName"`
+	Mileage   uint64 `json:"mileage"`
+}
+
+// clientID returns the identity of the client submitting the transaction
+func clientID(ctx contractapi.TransactionContextInterface) (string, error) {
+	id, err := ctx.GetClientIdentity().GetID()
+
+	if err != nil {
+		return "", fmt.Errorf("Failed to read client identity. %s", err.Error())
+	}
+
+	return id, nil
+}
+
+// assertOwner returns an error unless the submitting client owns the car
+func assertOwner(ctx contractapi.TransactionContextInterface, carNumber string, car *Car) error {
+	id, err := clientID(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if car.OwnerID == "" || car.OwnerID != id {
+		return newError(ErrForbidden, "only the owner of %s may do this", carNumber)
+	}
+
+	return nil
+}
+
+func transferKey(ctx contractapi.TransactionContextInterface, carNumber string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(transferIndex, []string{carNumber})
+}
+
+// QueryCarTransfer returns the pending transfer of the car with given id
+func (s *SmartContract) QueryCarTransfer(ctx contractapi.TransactionContextInterface, carNumber string) (*TransferOffer, error) {
+	key, err := transferKey(ctx, carNumber)
+
+	if err != nil {
+		return nil, err
+	}
+
+	offerAsBytes, err := ctx.GetStub().GetState(key)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read from world state. %s", err.Error())
+	}
+
+	if offerAsBytes == nil {
+		return nil, newError(ErrTransferNotFound, "%s has no pending transfer", carNumber)
+	}
+
+	offer := new(TransferOffer)
+
+	if err := json.Unmarshal(offerAsBytes, offer); err != nil {
+		return nil, fmt.Errorf("Failed to read transfer of %s. %s", carNumber, err.Error())
+	}
+
+	return offer, nil
+}
+
+// ChangeCarOwner offers the car with given id to a new owner at the given
+// mileage. Only the current owner may offer a car, the car must be listed for
+// sale, and ownership only moves once the client identified by newOwnerID
+// calls AcceptCarTransfer. The agreed price and buyer details of a sale may
+// be passed as JSON under "sale" in the transient map; they are kept in a
+// private data collection and become the car's sale details when a client of
+// the buyer org accepts the transfer, see GetSaleDetails
+func (s *SmartContract) ChangeCarOwner(ctx contractapi.TransactionContextInterface, carNumber string, newOwner string, newOwnerID string, mileage uint64) error {
+	if strings.TrimSpace(newOwner) == "" {
+		return newError(ErrInvalidArgument, "owner must not be empty")
+	}
+
+	if strings.TrimSpace(newOwnerID) == "" {
+		return newError(ErrInvalidArgument, "owner identity must not be empty")
+	}
+
+	car, err := s.QueryCar(ctx, carNumber)
+
+	if err != nil {
+		return err
+	}
+
+	if err := assertOwner(ctx, carNumber, car); err != nil {
+		return err
+	}
+
+	if err := car.assertTransferable(carNumber); err != nil {
+		return err
+	}
+
+	if car.CurrentStatus() != StatusForSale {
+		return newError(ErrInvalidState, "%s must be listed for sale before it is transferred", carNumber)
+	}
+
+	if car.OwnerID == newOwnerID {
+		return newError(ErrInvalidArgument, "%s is already owned by %s", carNumber, newOwnerID)
+	}
+
+	if err := car.checkMileage(carNumber, mileage); err != nil {
+		return err
+	}
+
+	if err := s.putPendingSale(ctx, carNumber); err != nil {
+		return err
+	}
+
+	offer := TransferOffer{
+		CarNumber: carNumber,
+		FromID:    car.OwnerID,
+		ToID:      newOwnerID,
+		ToName:    newOwner,
+		Mileage:   mileage,
+	}
+
+	offerAsBytes, err := json.Marshal(offer)
+
+	if err != nil {
+		return fmt.Errorf("Failed to marshal transfer of %s. %s", carNumber, err.Error())
+	}
+
+	key, err := transferKey(ctx, carNumber)
+
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState(key, offerAsBytes)
+}
+
+// AcceptCarTransfer completes the pending transfer of the car with given id.
+// Only the client the car was offered to may accept it. Emits OwnerChanged
+func (s *SmartContract) AcceptCarTransfer(ctx contractapi.TransactionContextInterface, carNumber string) error {
+	offer, err := s.QueryCarTransfer(ctx, carNumber)
+
+	if err != nil {
+		return err
+	}
+
+	id, err := clientID(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if offer.ToID != id {
+		return newError(ErrForbidden, "%s was not offered to this client", carNumber)
+	}
+
+	car, err := s.QueryCar(ctx, carNumber)
+
+	if err != nil {
+		return err
+	}
+
+	// The car may have changed hands since the offer was made
+	if car.OwnerID != offer.FromID {
+		return newError(ErrForbidden, "the transfer of %s is no longer valid", carNumber)
+	}
+
+	if err := car.assertTransferable(carNumber); err != nil {
+		return err
+	}
+
+	// A service may have been recorded since the offer was made
+	if err := car.checkMileage(carNumber, offer.Mileage); err != nil {
+		return err
+	}
+
+	if err := car.transition(carNumber, StatusSold); err != nil {
+		return err
+	}
+
+	event := OwnerChangedEvent{
+		CarNumber:       carNumber,
+		PreviousOwner:   car.Owner,
+		PreviousOwnerID: car.OwnerID,
+		NewOwner:        offer.ToName,
+		NewOwnerID:      offer.ToID,
+		Mileage:         offer.Mileage,
+		TxID:            ctx.GetStub().GetTxID(),
+	}
+
+	if err := s.completeSale(ctx, carNumber); err != nil {
+		return err
+	}
+
+	car.Owner = offer.ToName
+	car.OwnerID = offer.ToID
+	car.Mileage = offer.Mileage
+
+	if err := s.putCar(ctx, carNumber, car); err != nil {
+		return err
+	}
+
+	key, err := transferKey(ctx, carNumber)
+
+	if err != nil {
+		return err
+	}
+
+	if err := ctx.GetStub().DelState(key); err != nil {
+		return err
+	}
+
+	return setEvent(ctx, EventOwnerChanged, event)
+}
+
+// CancelCarTransfer withdraws the pending transfer of the car with given id.
+// Either the owner or the client the car was offered to may cancel it
+func (s *SmartContract) CancelCarTransfer(ctx contractapi.TransactionContextInterface, carNumber string) error {
+	offer, err := s.QueryCarTransfer(ctx, carNumber)
+
+	if err != nil {
+		return err
+	}
+
+	id, err := clientID(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if id != offer.FromID && id != offer.ToID {
+		return newError(ErrForbidden, "only the parties to the transfer of %s may cancel it", carNumber)
+	}
+
+	return s.clearTransfer(ctx, carNumber)
+}
+
+// clearTransfer removes the pending transfer of the car, if any, along with
+// the pending terms of its sale
+func (s *SmartContract) clearTransfer(ctx contractapi.TransactionContextInterface, carNumber string) error {
+	if err := s.discardPendingSale(ctx, carNumber); err != nil {
+		return err
+	}
+
+	key, err := transferKey(ctx, carNumber)
+
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().DelState(key)
+}
+
+// AssignOwner records the client identity of the owner of a car that was
+// stored without one, such as a car registered before owners were
+// identified. Until it is assigned nobody can offer, list or delete the car
+// as its owner. Only a registry admin may assign an owner, and only to a car
+// that has none. Emits OwnerChanged
+func (s *SmartContract) AssignOwner(ctx contractapi.TransactionContextInterface, carNumber string, ownerID string) error {
+	if !isRegistryAdmin(ctx) {
+		return newError(ErrForbidden, "only a registry admin may assign an owner")
+	}
+
+	if strings.TrimSpace(ownerID) == "" {
+		return newError(ErrInvalidArgument, "owner identity must not be empty")
+	}
+
+	car, err := s.QueryCar(ctx, carNumber)
+
+	if err != nil {
+		return err
+	}
+
+	if car.OwnerID != "" {
+		return newError(ErrInvalidState, "%s already has an owner identity", carNumber)
+	}
+
+	car.OwnerID = ownerID
+
+	if err := s.putCar(ctx, carNumber, car); err != nil {
+		return err
+	}
+
+	return setEvent(ctx, EventOwnerChanged, OwnerChangedEvent{
+		CarNumber:     carNumber,
+		PreviousOwner: car.Owner,
+		NewOwner:      car.Owner,
+		NewOwnerID:    ownerID,
+		Mileage:       car.Mileage,
+		TxID:          ctx.GetStub().GetTxID(),
+	})
+}
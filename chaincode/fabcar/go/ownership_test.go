@@ -0,0 +1,167 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// offerCar lists the car owned by alice for sale and offers it to bob
+func offerCar(t *testing.T, ctx *fakeContext, carNumber string, mileage uint64) {
+	t.Helper()
+	s := new(SmartContract)
+	assertNoError(t, s.ListForSale(ctx.as(alice), carNumber))
+	assertNoError(t, s.ChangeCarOwner(ctx.as(alice), carNumber, "Bob", "bob", mileage))
+}
+
+func TestChangeCarOwner(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+	createCar(t, ctx, "CAR1", vin1)
+	offerCar(t, ctx, "CAR1", 1000)
+
+	offer, err := s.QueryCarTransfer(ctx.as(carol), "CAR1")
+	assertNoError(t, err)
+
+	expected := TransferOffer{CarNumber: "CAR1", FromID: "alice", ToID: "bob", ToName: "Bob", Mileage: 1000}
+	if *offer != expected {
+		t.Fatalf("expected %+v, got %+v", expected, *offer)
+	}
+
+	// The car does not change hands until the offer is accepted
+	car, err := s.QueryCar(ctx.as(alice), "CAR1")
+	assertNoError(t, err)
+
+	if car.OwnerID != "alice" || car.Mileage != 0 {
+		t.Fatalf("car changed before acceptance: %+v", car)
+	}
+}
+
+func TestChangeCarOwner_Invalid(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+	createCar(t, ctx, "CAR1", vin1)
+	createCar(t, ctx, "CAR2", vin2)
+	assertNoError(t, s.ListForSale(ctx.as(alice), "CAR1"))
+
+	tests := []struct {
+		name      string
+		client    *fakeIdentity
+		carNumber string
+		newOwner  string
+		ownerID   string
+		code      ErrorCode
+	}{
+		{"empty owner", alice, "CAR1", "", "bob", ErrInvalidArgument},
+		{"empty owner identity", alice, "CAR1", "Bob", " ", ErrInvalidArgument},
+		{"missing car", alice, "CAR3", "Bob", "bob", ErrCarNotFound},
+		{"not the owner", bob, "CAR1", "Bob", "bob", ErrForbidden},
+		{"not for sale", alice, "CAR2", "Bob", "bob", ErrInvalidState},
+		{"already the owner", alice, "CAR1", "Alice", "alice", ErrInvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.ChangeCarOwner(ctx.as(tt.client), tt.carNumber, tt.newOwner, tt.ownerID, 0)
+			assertCode(t, err, tt.code)
+		})
+	}
+}
+
+func TestAcceptCarTransfer(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+	createCar(t, ctx, "CAR1", vin1)
+	offerCar(t, ctx, "CAR1", 1000)
+
+	assertCode(t, s.AcceptCarTransfer(ctx.as(carol), "CAR1"), ErrForbidden)
+	assertNoError(t, s.AcceptCarTransfer(ctx.as(bob), "CAR1"))
+
+	car, err := s.QueryCar(ctx.as(bob), "CAR1")
+	assertNoError(t, err)
+
+	if car.Owner != "Bob" || car.OwnerID != "bob" || car.Mileage != 1000 || car.Status != StatusSold {
+		t.Fatalf("unexpected car after transfer: %+v", car)
+	}
+
+	_, err = s.QueryCarTransfer(ctx.as(bob), "CAR1")
+	assertCode(t, err, ErrTransferNotFound)
+}
+
+func TestAcceptCarTransfer_Stale(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+	createCar(t, ctx, "CAR1", vin1)
+	offerCar(t, ctx, "CAR1", 1000)
+
+	// Reporting the car stolen cancels the offer
+	assertNoError(t, s.ReportStolen(ctx.as(alice), "CAR1"))
+	assertCode(t, s.AcceptCarTransfer(ctx.as(bob), "CAR1"), ErrTransferNotFound)
+}
+
+func TestAcceptCarTransfer_MileageDecreased(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+	createCar(t, ctx, "CAR1", vin1)
+	offerCar(t, ctx, "CAR1", 1000)
+
+	assertNoError(t, s.AddServiceRecord(ctx.as(garage), "CAR1", "2019-12-01", 2000, "Kwik Fit", "oil change"))
+	assertCode(t, s.AcceptCarTransfer(ctx.as(bob), "CAR1"), ErrMileageDecreased)
+}
+
+func TestCancelCarTransfer(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+	createCar(t, ctx, "CAR1", vin1)
+	createCar(t, ctx, "CAR2", vin2)
+	offerCar(t, ctx, "CAR1", 0)
+	offerCar(t, ctx, "CAR2", 0)
+
+	assertCode(t, s.CancelCarTransfer(ctx.as(carol), "CAR1"), ErrForbidden)
+	assertNoError(t, s.CancelCarTransfer(ctx.as(alice), "CAR1"))
+	assertNoError(t, s.CancelCarTransfer(ctx.as(bob), "CAR2"))
+	assertCode(t, s.CancelCarTransfer(ctx.as(alice), "CAR1"), ErrTransferNotFound)
+	assertCode(t, s.AcceptCarTransfer(ctx.as(bob), "CAR2"), ErrTransferNotFound)
+}
+
+func TestQueryCarTransfer_CorruptJSON(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+	key, _ := ctx.stub.CreateCompositeKey(transferIndex, []string{"CAR1"})
+	ctx.putRaw(t, key, "{")
+
+	_, err := s.QueryCarTransfer(ctx.as(alice), "CAR1")
+	if err == nil {
+		t.Fatal("expected an error reading a corrupt transfer")
+	}
+}
+
+func TestAssignOwner(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+	ctx.putRaw(t, "CAR1", legacyCar)
+
+	// A car stored without an owner identity cannot be used by anyone
+	assertCode(t, s.ListForSale(ctx.as(alice), "CAR1"), ErrForbidden)
+
+	assertCode(t, s.AssignOwner(ctx.as(alice), "CAR1", "alice"), ErrForbidden)
+	assertCode(t, s.AssignOwner(ctx.as(admin), "CAR1", " "), ErrInvalidArgument)
+	assertCode(t, s.AssignOwner(ctx.as(admin), "CAR9", "alice"), ErrCarNotFound)
+	assertNoError(t, s.AssignOwner(ctx.as(admin), "CAR1", "alice"))
+
+	var changed OwnerChangedEvent
+	assertNoError(t, json.Unmarshal(ctx.lastEvent(t).Payload, &changed))
+
+	if changed.NewOwner != "Tomoko" || changed.NewOwnerID != "alice" || changed.PreviousOwnerID != "" {
+		t.Fatalf("unexpected event %+v", changed)
+	}
+
+	assertCode(t, s.AssignOwner(ctx.as(admin), "CAR1", "bob"), ErrInvalidState)
+
+	// The assigned owner can now sell the car
+	offerCar(t, ctx, "CAR1", 0)
+	assertNoError(t, s.AcceptCarTransfer(ctx.as(bob), "CAR1"))
+}
@@ -0,0 +1,118 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// counterIndex is the composite key prefix for counters
+const counterIndex = "counter~name"
+
+// carNumberCounter names the counter sequential car numbers are allocated from
+const carNumberCounter = "carNumber"
+
+// Car numbers are zero padded so they sort in the order they were allocated.
+// Numbers derived from transaction ids are longer, so the two never collide
+const (
+	sequentialCarNumberFormat = "CAR%08d"
+	txIDCarNumberFormat       = "CAR%020d"
+)
+
+// nextCarNumber allocates the next unused sequential car number from the
+// counter. Every call reads and writes the counter, so concurrent
+// transactions allocating numbers fail MVCC validation and must be retried
+func (s *SmartContract) nextCarNumber(ctx contractapi.TransactionContextInterface) (string, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(counterIndex, []string{carNumberCounter})
+
+	if err != nil {
+		return "", err
+	}
+
+	counterAsBytes, err := ctx.GetStub().GetState(key)
+
+	if err != nil {
+		return "", fmt.Errorf("Failed to read from world state. %s", err.Error())
+	}
+
+	counter := uint64(0)
+
+	if counterAsBytes != nil {
+		counter, err = strconv.ParseUint(string(counterAsBytes), 10, 64)
+
+		if err != nil {
+			return "", newError(ErrMalformedRecord, "car number counter %q is not a number", counterAsBytes)
+		}
+	}
+
+	// Skip numbers already taken by cars created with CreateCar, including
+	// cars that have since been archived
+	for {
+		counter++
+		carNumber := fmt.Sprintf(sequentialCarNumberFormat, counter)
+
+		exists, err := s.carExists(ctx, carNumber)
+
+		if err != nil {
+			return "", err
+		}
+
+		archived, err := s.isArchived(ctx, carNumber)
+
+		if err != nil {
+			return "", err
+		}
+
+		if !exists && !archived {
+			if err := ctx.GetStub().PutState(key, []byte(strconv.FormatUint(counter, 10))); err != nil {
+				return "", fmt.Errorf("Failed to put to world state. %s", err.Error())
+			}
+
+			return carNumber, nil
+		}
+	}
+}
+
+// txIDCarNumber derives a car number from the transaction id, which needs no
+// shared state and so never conflicts with concurrent registrations
+func txIDCarNumber(ctx contractapi.TransactionContextInterface) (string, error) {
+	txID, err := hex.DecodeString(ctx.GetStub().GetTxID())
+
+	if err != nil || len(txID) < 8 {
+		return "", fmt.Errorf("Failed to derive car number from transaction id %s", ctx.GetStub().GetTxID())
+	}
+
+	return fmt.Sprintf(txIDCarNumberFormat, binary.BigEndian.Uint64(txID)), nil
+}
+
+// RegisterCar adds a new car with given details under a car number allocated
+// by the contract, and returns the number. Numbers are sequential unless
+// fromTxID is set, in which case the number is derived from the transaction
+// id; use this when registering many cars concurrently. Emits CarCreated
+func (s *SmartContract) RegisterCar(ctx contractapi.TransactionContextInterface, make string, model string, colour string, owner string, vin string, fromTxID bool) (string, error) {
+	var carNumber string
+	var err error
+
+	if fromTxID {
+		carNumber, err = txIDCarNumber(ctx)
+	} else {
+		carNumber, err = s.nextCarNumber(ctx)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.CreateCar(ctx, carNumber, make, model, colour, owner, vin); err != nil {
+		return "", err
+	}
+
+	return carNumber, nil
+}
@@ -0,0 +1,85 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package main
+
+import (
+	"testing"
+)
+
+func TestRegisterCar_Sequential(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+	assertNoError(t, s.CreateCar(ctx.as(alice), "CAR00000002", "Ford", "Ka", "red", "Brad", vin2))
+
+	expected := []string{"CAR00000001", "CAR00000003", "CAR00000004"}
+	for i, carNumber := range expected {
+		allocated, err := s.RegisterCar(ctx.as(alice), "Toyota", "Prius", "blue", "Tomoko", testVIN(i), false)
+		assertNoError(t, err)
+
+		if allocated != carNumber {
+			t.Fatalf("expected %s, got %s", carNumber, allocated)
+		}
+	}
+
+	car, err := s.QueryCar(ctx.as(alice), "CAR00000004")
+	assertNoError(t, err)
+
+	if car.OwnerID != "alice" || car.Make != "Toyota" {
+		t.Fatalf("unexpected car %+v", car)
+	}
+
+	if ctx.lastEvent(t).EventName != EventCarCreated {
+		t.Fatal("expected a CarCreated event")
+	}
+
+	// The allocated numbers fall in the range QueryAllCars reads
+	results, err := s.QueryAllCars(ctx.as(alice))
+	assertNoError(t, err)
+
+	if len(results) != 4 {
+		t.Fatalf("expected 4 cars, got %d", len(results))
+	}
+}
+
+func TestRegisterCar_Invalid(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+
+	_, err := s.RegisterCar(ctx.as(alice), "", "Prius", "blue", "Tomoko", vin1, false)
+	assertCode(t, err, ErrInvalidArgument)
+
+	key, _ := ctx.stub.CreateCompositeKey(counterIndex, []string{carNumberCounter})
+	ctx.putRaw(t, key, "x")
+	_, err = s.RegisterCar(ctx.as(alice), "Toyota", "Prius", "blue", "Tomoko", vin1, false)
+	assertCode(t, err, ErrMalformedRecord)
+}
+
+func TestRegisterCar_FromTxID(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+
+	ctx.as(alice)
+	ctx.stub.MockTransactionStart("00000000000000ff8c1e3a3b0f6a9b4bd2c7a7e3c2f7b8f1f4d5e6a7b8c9d0e1")
+	carNumber, err := s.RegisterCar(ctx, "Toyota", "Prius", "blue", "Tomoko", vin1, true)
+	assertNoError(t, err)
+
+	if carNumber != "CAR00000000000000000255" {
+		t.Fatalf("unexpected car number %s", carNumber)
+	}
+
+	if _, err := s.QueryCar(ctx.as(alice), carNumber); err != nil {
+		t.Fatalf("expected %s to exist: %s", carNumber, err)
+	}
+
+	// Allocating from the transaction id leaves the counter untouched
+	key, _ := ctx.stub.CreateCompositeKey(counterIndex, []string{carNumberCounter})
+	if ctx.stub.State[key] != nil {
+		t.Fatal("expected the counter not to be written")
+	}
+
+	if _, err := s.RegisterCar(ctx.as(alice), "Toyota", "Prius", "blue", "Tomoko", vin2, true); err == nil {
+		t.Fatal("expected an error for a transaction id that is not hex")
+	}
+}
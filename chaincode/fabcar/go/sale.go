@@ -0,0 +1,213 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// saleCollection is the private data collection holding sale details. It is
+// defined in collections_config.json
+const saleCollection = "collectionCarSales"
+
+// saleTransientKey is the transient map key ChangeCarOwner reads sale
+// details from
+const saleTransientKey = "sale"
+
+// pendingSaleIndex is the composite key prefix, within the sale collection,
+// of the terms of a sale that has been offered but not yet accepted
+const pendingSaleIndex = "pendingSale~carNumber"
+
+// SaleDetails holds the private terms of a sale. Only a hash of them is
+// written to the channel ledger. TxID is the transaction that completed the
+// sale
+type SaleDetails struct {
+	CarNumber    string  `json:"carNumber"`
+	Price        float64 `json:"price"`
+	BuyerContact string  `json:"buyerContact"`
+	BuyerMSP     string  `json:"buyerMSP"`
+	SellerMSP    string  `json:"sellerMSP"`
+	TxID         string  `json:"txId"`
+}
+
+func pendingSaleKey(ctx contractapi.TransactionContextInterface, carNumber string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(pendingSaleIndex, []string{carNumber})
+}
+
+// putPendingSale stores the sale details passed in the transient map, if any,
+// as the pending terms of the sale of the car. They only become the car's
+// sale details when the buyer accepts the transfer. An offer without details
+// discards those of an earlier offer. The seller is the submitting client's
+// org
+func (s *SmartContract) putPendingSale(ctx contractapi.TransactionContextInterface, carNumber string) error {
+	transMap, err := ctx.GetStub().GetTransient()
+
+	if err != nil {
+		return fmt.Errorf("Failed to read transient data. %s", err.Error())
+	}
+
+	saleAsBytes, ok := transMap[saleTransientKey]
+
+	if !ok {
+		return s.discardPendingSale(ctx, carNumber)
+	}
+
+	sale := new(SaleDetails)
+
+	if err := json.Unmarshal(saleAsBytes, sale); err != nil {
+		return newError(ErrInvalidArgument, "%s in the transient map must be a JSON object. %s", saleTransientKey, err.Error())
+	}
+
+	if sale.Price <= 0 {
+		return newError(ErrInvalidArgument, "sale price must be greater than zero")
+	}
+
+	if strings.TrimSpace(sale.BuyerContact) == "" {
+		return newError(ErrInvalidArgument, "buyer contact must not be empty")
+	}
+
+	if strings.TrimSpace(sale.BuyerMSP) == "" {
+		return newError(ErrInvalidArgument, "buyer MSP must not be empty")
+	}
+
+	sellerMSP, err := ctx.GetClientIdentity().GetMSPID()
+
+	if err != nil {
+		return fmt.Errorf("Failed to read client MSP. %s", err.Error())
+	}
+
+	sale.CarNumber = carNumber
+	sale.SellerMSP = sellerMSP
+
+	saleAsBytes, err = json.Marshal(sale)
+
+	if err != nil {
+		return fmt.Errorf("Failed to marshal sale of %s. %s", carNumber, err.Error())
+	}
+
+	key, err := pendingSaleKey(ctx, carNumber)
+
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutPrivateData(saleCollection, key, saleAsBytes)
+}
+
+// completeSale records the pending terms of the sale of the car as its sale
+// details. A transfer without terms removes the details of an earlier sale,
+// so they are never reported as those of the latest one. The client
+// accepting the transfer must belong to the buyer org named in the terms
+func (s *SmartContract) completeSale(ctx contractapi.TransactionContextInterface, carNumber string) error {
+	key, err := pendingSaleKey(ctx, carNumber)
+
+	if err != nil {
+		return err
+	}
+
+	saleAsBytes, err := ctx.GetStub().GetPrivateData(saleCollection, key)
+
+	if err != nil {
+		return fmt.Errorf("Failed to read from private data. %s", err.Error())
+	}
+
+	if saleAsBytes == nil {
+		return ctx.GetStub().DelPrivateData(saleCollection, carNumber)
+	}
+
+	sale := new(SaleDetails)
+
+	if err := json.Unmarshal(saleAsBytes, sale); err != nil {
+		return fmt.Errorf("Failed to read sale of %s. %s", carNumber, err.Error())
+	}
+
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+
+	if err != nil {
+		return fmt.Errorf("Failed to read client MSP. %s", err.Error())
+	}
+
+	if mspID != sale.BuyerMSP {
+		return newError(ErrForbidden, "%s was sold to a client of %s, not %s", carNumber, sale.BuyerMSP, mspID)
+	}
+
+	sale.TxID = ctx.GetStub().GetTxID()
+	saleAsBytes, err = json.Marshal(sale)
+
+	if err != nil {
+		return fmt.Errorf("Failed to marshal sale of %s. %s", carNumber, err.Error())
+	}
+
+	if err := ctx.GetStub().PutPrivateData(saleCollection, carNumber, saleAsBytes); err != nil {
+		return err
+	}
+
+	return ctx.GetStub().DelPrivateData(saleCollection, key)
+}
+
+// discardPendingSale removes the pending terms of the sale of the car, if any
+func (s *SmartContract) discardPendingSale(ctx contractapi.TransactionContextInterface, carNumber string) error {
+	key, err := pendingSaleKey(ctx, carNumber)
+
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().DelPrivateData(saleCollection, key)
+}
+
+// GetSaleDetails returns the private terms of the latest sale of the car with
+// given id. Only clients of the buyer and seller orgs may read them
+func (s *SmartContract) GetSaleDetails(ctx contractapi.TransactionContextInterface, carNumber string) (*SaleDetails, error) {
+	saleAsBytes, err := ctx.GetStub().GetPrivateData(saleCollection, carNumber)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read from private data. %s", err.Error())
+	}
+
+	if saleAsBytes == nil {
+		return nil, newError(ErrSaleNotFound, "%s has no recorded sale", carNumber)
+	}
+
+	sale := new(SaleDetails)
+
+	if err := json.Unmarshal(saleAsBytes, sale); err != nil {
+		return nil, fmt.Errorf("Failed to read sale of %s. %s", carNumber, err.Error())
+	}
+
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read client MSP. %s", err.Error())
+	}
+
+	if mspID != sale.BuyerMSP && mspID != sale.SellerMSP {
+		return nil, newError(ErrForbidden, "only the buyer and seller orgs may read the sale of %s", carNumber)
+	}
+
+	return sale, nil
+}
+
+// GetSaleDetailsHash returns the hex encoded hash of the latest sale details
+// of the car with given id, as recorded on the channel ledger. Parties can
+// compare it against a hash of the details they hold
+func (s *SmartContract) GetSaleDetailsHash(ctx contractapi.TransactionContextInterface, carNumber string) (string, error) {
+	hash, err := ctx.GetStub().GetPrivateDataHash(saleCollection, carNumber)
+
+	if err != nil {
+		return "", fmt.Errorf("Failed to read private data hash. %s", err.Error())
+	}
+
+	if hash == nil {
+		return "", newError(ErrSaleNotFound, "%s has no recorded sale", carNumber)
+	}
+
+	return hex.EncodeToString(hash), nil
+}
@@ -0,0 +1,162 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+// offerCarWithSale offers the car owned by alice to bob with the given sale
+// details in the transient map
+func offerCarWithSale(ctx *fakeContext, carNumber string, sale string) error {
+	s := new(SmartContract)
+
+	if err := s.ListForSale(ctx.as(alice), carNumber); err != nil {
+		return err
+	}
+
+	ctx.as(alice)
+	ctx.stub.Transient = map[string][]byte{saleTransientKey: []byte(sale)}
+
+	return s.ChangeCarOwner(ctx, carNumber, "Bob", "bob", 0)
+}
+
+func TestGetSaleDetails(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+	createCar(t, ctx, "CAR1", vin1)
+	assertNoError(t, offerCarWithSale(ctx, "CAR1", `{"price":12500,"buyerContact":"bob@example.com","buyerMSP":"Org2MSP"}`))
+
+	// The terms are not the car's sale details until the offer is accepted
+	_, err := s.GetSaleDetails(ctx.as(alice), "CAR1")
+	assertCode(t, err, ErrSaleNotFound)
+
+	assertNoError(t, s.AcceptCarTransfer(ctx.as(bob), "CAR1"))
+	txID := ctx.stub.TxID
+
+	for _, client := range []*fakeIdentity{alice, bob} {
+		sale, err := s.GetSaleDetails(ctx.as(client), "CAR1")
+		assertNoError(t, err)
+
+		expected := SaleDetails{CarNumber: "CAR1", Price: 12500, BuyerContact: "bob@example.com", BuyerMSP: "Org2MSP", SellerMSP: "Org1MSP", TxID: txID}
+		if *sale != expected {
+			t.Fatalf("expected %+v, got %+v", expected, *sale)
+		}
+	}
+
+	_, err = s.GetSaleDetails(ctx.as(carol), "CAR1")
+	assertCode(t, err, ErrForbidden)
+
+	hash, err := s.GetSaleDetailsHash(ctx.as(carol), "CAR1")
+	assertNoError(t, err)
+
+	stored := sha256.Sum256(ctx.stub.PvtState[saleCollection]["CAR1"])
+	if hash != hex.EncodeToString(stored[:]) {
+		t.Fatalf("unexpected hash %s", hash)
+	}
+}
+
+func TestGetSaleDetails_Missing(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+	createCar(t, ctx, "CAR1", vin1)
+	offerCar(t, ctx, "CAR1", 0)
+
+	_, err := s.GetSaleDetails(ctx.as(alice), "CAR1")
+	assertCode(t, err, ErrSaleNotFound)
+
+	_, err = s.GetSaleDetailsHash(ctx.as(alice), "CAR1")
+	assertCode(t, err, ErrSaleNotFound)
+}
+
+func TestGetSaleDetails_Cancelled(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+	createCar(t, ctx, "CAR1", vin1)
+	assertNoError(t, offerCarWithSale(ctx, "CAR1", `{"price":12500,"buyerContact":"bob@example.com","buyerMSP":"Org2MSP"}`))
+	assertNoError(t, s.CancelCarTransfer(ctx.as(bob), "CAR1"))
+
+	// A later offer without terms is accepted; the cancelled terms are gone
+	assertNoError(t, s.ChangeCarOwner(ctx.as(alice), "CAR1", "Bob", "bob", 0))
+	assertNoError(t, s.AcceptCarTransfer(ctx.as(bob), "CAR1"))
+
+	_, err := s.GetSaleDetails(ctx.as(alice), "CAR1")
+	assertCode(t, err, ErrSaleNotFound)
+
+	if len(ctx.stub.PvtState[saleCollection]) != 0 {
+		t.Fatalf("expected no sale data, got %v", ctx.stub.PvtState[saleCollection])
+	}
+}
+
+func TestGetSaleDetails_Superseded(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+	createCar(t, ctx, "CAR1", vin1)
+	assertNoError(t, offerCarWithSale(ctx, "CAR1", `{"price":12500,"buyerContact":"bob@example.com","buyerMSP":"Org2MSP"}`))
+	assertNoError(t, s.AcceptCarTransfer(ctx.as(bob), "CAR1"))
+
+	// bob hands the car back without terms, so the first sale is no longer
+	// the latest
+	assertNoError(t, s.ListForSale(ctx.as(bob), "CAR1"))
+	assertNoError(t, s.ChangeCarOwner(ctx.as(bob), "CAR1", "Tomoko", "alice", 0))
+	assertNoError(t, s.AcceptCarTransfer(ctx.as(alice), "CAR1"))
+
+	_, err := s.GetSaleDetails(ctx.as(alice), "CAR1")
+	assertCode(t, err, ErrSaleNotFound)
+
+	_, err = s.GetSaleDetailsHash(ctx.as(alice), "CAR1")
+	assertCode(t, err, ErrSaleNotFound)
+}
+
+func TestDeleteCar_DiscardsSale(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+	createCar(t, ctx, "CAR1", vin1)
+	assertNoError(t, offerCarWithSale(ctx, "CAR1", `{"price":12500,"buyerContact":"bob@example.com","buyerMSP":"Org2MSP"}`))
+
+	assertNoError(t, s.DeleteCar(ctx.as(alice), "CAR1"))
+
+	if len(ctx.stub.PvtState[saleCollection]) != 0 {
+		t.Fatalf("expected no sale data, got %v", ctx.stub.PvtState[saleCollection])
+	}
+}
+
+func TestAcceptCarTransfer_WrongBuyerMSP(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+	createCar(t, ctx, "CAR1", vin1)
+	assertNoError(t, offerCarWithSale(ctx, "CAR1", `{"price":12500,"buyerContact":"bob@example.com","buyerMSP":"Org3MSP"}`))
+
+	assertCode(t, s.AcceptCarTransfer(ctx.as(bob), "CAR1"), ErrForbidden)
+
+	car, err := s.QueryCar(ctx.as(alice), "CAR1")
+	assertNoError(t, err)
+
+	if car.OwnerID != "alice" {
+		t.Fatalf("expected the car not to change hands, got %+v", car)
+	}
+}
+
+func TestPutSaleDetails_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		sale string
+	}{
+		{"not JSON", `price=100`},
+		{"no price", `{"buyerContact":"bob@example.com","buyerMSP":"Org2MSP"}`},
+		{"no contact", `{"price":100,"buyerMSP":"Org2MSP"}`},
+		{"no buyer MSP", `{"price":100,"buyerContact":"bob@example.com"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := newFakeContext()
+			createCar(t, ctx, "CAR1", vin1)
+			assertCode(t, offerCarWithSale(ctx, "CAR1", tt.sale), ErrInvalidArgument)
+		})
+	}
+}
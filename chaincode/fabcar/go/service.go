@@ -0,0 +1,149 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// serviceIndex is the composite key prefix for service records, keyed by car
+// number and a zero padded sequence number so records iterate in order
+const serviceIndex = "service~carNumber~seq"
+
+// garageAttribute is the certificate attribute a client needs to add
+// service records
+const garageAttribute = "garage"
+
+// ServiceRecord describes one service of a car
+type ServiceRecord struct {
+	CarNumber   string `json:"carNumber"`
+	Sequence    int    `json:"sequence"`
+	Date        string `json:"date"`
+	Mileage     uint64 `json:"mileage"`
+	Garage      string `json:"garage"`
+	Description string `json:"description"`
+	GarageID    string `json:"garageId"`
+	TxID        string `json:"txId"`
+}
+
+// checkMileage returns an error if mileage is lower than the last reading
+// recorded for the car, which would indicate the odometer was rolled back
+func (c *Car) checkMileage(carNumber string, mileage uint64) error {
+	if mileage < c.Mileage {
+		return newError(ErrMileageDecreased, "mileage %d for %s is lower than the recorded %d", mileage, carNumber, c.Mileage)
+	}
+
+	return nil
+}
+
+// AddServiceRecord appends a service record to the log of the car with given
+// id and updates its recorded mileage. Only clients whose certificate has the
+// garage attribute set to true may add records
+func (s *SmartContract) AddServiceRecord(ctx contractapi.TransactionContextInterface, carNumber string, date string, mileage uint64, garage string, description string) error {
+	if err := ctx.GetClientIdentity().AssertAttributeValue(garageAttribute, "true"); err != nil {
+		return newError(ErrForbidden, "only garages may add service records. %s", err.Error())
+	}
+
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		return newError(ErrInvalidArgument, "date %q must have the form YYYY-MM-DD", date)
+	}
+
+	if strings.TrimSpace(garage) == "" {
+		return newError(ErrInvalidArgument, "garage must not be empty")
+	}
+
+	car, err := s.QueryCar(ctx, carNumber)
+
+	if err != nil {
+		return err
+	}
+
+	if car.CurrentStatus() == StatusScrapped {
+		return newError(ErrInvalidState, "%s is scrapped", carNumber)
+	}
+
+	if err := car.checkMileage(carNumber, mileage); err != nil {
+		return err
+	}
+
+	records, err := s.GetServiceRecords(ctx, carNumber)
+
+	if err != nil {
+		return err
+	}
+
+	garageID, err := clientID(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	record := ServiceRecord{
+		CarNumber:   carNumber,
+		Sequence:    len(records) + 1,
+		Date:        date,
+		Mileage:     mileage,
+		Garage:      garage,
+		Description: description,
+		GarageID:    garageID,
+		TxID:        ctx.GetStub().GetTxID(),
+	}
+
+	recordAsBytes, err := json.Marshal(record)
+
+	if err != nil {
+		return fmt.Errorf("Failed to marshal service record for %s. %s", carNumber, err.Error())
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(serviceIndex, []string{carNumber, fmt.Sprintf("%06d", record.Sequence)})
+
+	if err != nil {
+		return err
+	}
+
+	if err := ctx.GetStub().PutState(key, recordAsBytes); err != nil {
+		return fmt.Errorf("Failed to put to world state. %s", err.Error())
+	}
+
+	car.Mileage = mileage
+
+	return s.putCar(ctx, carNumber, car)
+}
+
+// GetServiceRecords returns the service records of the car with given id in
+// the order they were added
+func (s *SmartContract) GetServiceRecords(ctx contractapi.TransactionContextInterface, carNumber string) ([]ServiceRecord, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(serviceIndex, []string{carNumber})
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read from world state. %s", err.Error())
+	}
+	defer resultsIterator.Close()
+
+	records := []ServiceRecord{}
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+
+		if err != nil {
+			return nil, err
+		}
+
+		var record ServiceRecord
+
+		if err := json.Unmarshal(queryResponse.Value, &record); err != nil {
+			return nil, fmt.Errorf("Failed to read service record %s. %s", queryResponse.Key, err.Error())
+		}
+
+		records = append(records, record)
+	}
+
+	return records, nil
+}
@@ -0,0 +1,77 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package main
+
+import (
+	"testing"
+)
+
+func TestAddServiceRecord(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+	createCar(t, ctx, "CAR1", vin1)
+
+	assertNoError(t, s.AddServiceRecord(ctx.as(garage), "CAR1", "2019-06-01", 5000, "Kwik Fit", "oil change"))
+	assertNoError(t, s.AddServiceRecord(ctx.as(garage), "CAR1", "2019-12-01", 9000, "Kwik Fit", "new tyres"))
+
+	records, err := s.GetServiceRecords(ctx.as(alice), "CAR1")
+	assertNoError(t, err)
+
+	if len(records) != 2 || records[0].Sequence != 1 || records[1].Sequence != 2 || records[1].Description != "new tyres" || records[1].GarageID != "garage" {
+		t.Fatalf("unexpected records %+v", records)
+	}
+
+	car, err := s.QueryCar(ctx.as(alice), "CAR1")
+	assertNoError(t, err)
+
+	if car.Mileage != 9000 {
+		t.Fatalf("expected mileage 9000, got %d", car.Mileage)
+	}
+}
+
+func TestAddServiceRecord_Invalid(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+	createCar(t, ctx, "CAR1", vin1)
+	createCar(t, ctx, "CAR2", vin2)
+	assertNoError(t, s.AddServiceRecord(ctx.as(garage), "CAR1", "2019-06-01", 5000, "Kwik Fit", "oil change"))
+	assertNoError(t, s.Scrap(ctx.as(alice), "CAR2"))
+
+	tests := []struct {
+		name      string
+		client    *fakeIdentity
+		carNumber string
+		date      string
+		mileage   uint64
+		garage    string
+		code      ErrorCode
+	}{
+		{"not a garage", alice, "CAR1", "2019-12-01", 6000, "Kwik Fit", ErrForbidden},
+		{"bad date", garage, "CAR1", "01/12/2019", 6000, "Kwik Fit", ErrInvalidArgument},
+		{"empty garage", garage, "CAR1", "2019-12-01", 6000, "", ErrInvalidArgument},
+		{"missing car", garage, "CAR3", "2019-12-01", 6000, "Kwik Fit", ErrCarNotFound},
+		{"scrapped car", garage, "CAR2", "2019-12-01", 6000, "Kwik Fit", ErrInvalidState},
+		{"rolled back", garage, "CAR1", "2019-12-01", 4999, "Kwik Fit", ErrMileageDecreased},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.AddServiceRecord(ctx.as(tt.client), tt.carNumber, tt.date, tt.mileage, tt.garage, "service")
+			assertCode(t, err, tt.code)
+		})
+	}
+}
+
+func TestGetServiceRecords_Empty(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+
+	records, err := s.GetServiceRecords(ctx.as(alice), "CAR1")
+	assertNoError(t, err)
+
+	if records == nil || len(records) != 0 {
+		t.Fatalf("expected an empty list, got %v", records)
+	}
+}
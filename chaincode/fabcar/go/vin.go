@@ -0,0 +1,140 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// vinIndex is the composite key index mapping a VIN to its car number
+const vinIndex = "vin~carNumber"
+
+// vinWeights are the ISO 3779 position weights used for the check digit
+var vinWeights = [17]int{8, 7, 6, 5, 4, 3, 2, 10, 0, 9, 8, 7, 6, 5, 4, 3, 2}
+
+// vinValue transliterates a VIN character to its numeric value. The letters
+// I, O and Q are not allowed in a VIN.
+func vinValue(c byte) (int, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0'), true
+	case c >= 'A' && c <= 'H':
+		return int(c-'A') + 1, true
+	case c >= 'J' && c <= 'N':
+		return int(c-'J') + 1, true
+	case c == 'P':
+		return 7, true
+	case c == 'R':
+		return 9, true
+	case c >= 'S' && c <= 'Z':
+		return int(c-'S') + 2, true
+	}
+
+	return 0, false
+}
+
+// validateVIN checks the length, characters and check digit of a VIN
+func validateVIN(vin string) error {
+	if len(vin) != len(vinWeights) {
+		return newError(ErrInvalidArgument, "VIN %q must be %d characters long", vin, len(vinWeights))
+	}
+
+	sum := 0
+
+	for i := 0; i < len(vin); i++ {
+		value, ok := vinValue(vin[i])
+
+		if !ok {
+			return newError(ErrInvalidArgument, "VIN %q contains invalid character %q", vin, vin[i])
+		}
+
+		sum += value * vinWeights[i]
+	}
+
+	checkDigit := byte('0' + sum%11)
+
+	if sum%11 == 10 {
+		checkDigit = 'X'
+	}
+
+	if vin[8] != checkDigit {
+		return newError(ErrInvalidArgument, "VIN %q has an invalid check digit", vin)
+	}
+
+	return nil
+}
+
+// carNumberForVIN returns the number of the car registered with the VIN, or
+// an empty string if there is none
+func (s *SmartContract) carNumberForVIN(ctx contractapi.TransactionContextInterface, vin string) (string, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(vinIndex, []string{vin})
+
+	if err != nil {
+		return "", fmt.Errorf("Failed to read from world state. %s", err.Error())
+	}
+	defer resultsIterator.Close()
+
+	if !resultsIterator.HasNext() {
+		return "", nil
+	}
+
+	responseRange, err := resultsIterator.Next()
+
+	if err != nil {
+		return "", err
+	}
+
+	_, compositeKeyParts, err := ctx.GetStub().SplitCompositeKey(responseRange.Key)
+
+	if err != nil {
+		return "", err
+	}
+
+	return compositeKeyParts[1], nil
+}
+
+// normalizeVIN returns the VIN in the upper case form it is stored and indexed
+// under
+func normalizeVIN(vin string) string {
+	return strings.ToUpper(vin)
+}
+
+// putVINIndex records that the car with given id carries the VIN
+func (s *SmartContract) putVINIndex(ctx contractapi.TransactionContextInterface, vin string, carNumber string) error {
+	vinIndexKey, err := ctx.GetStub().CreateCompositeKey(vinIndex, []string{vin, carNumber})
+
+	if err != nil {
+		return err
+	}
+
+	// Save index entry to world state. Only the key name is needed, no need to
+	// store a duplicate copy of the car, so the value is a nil character
+	return ctx.GetStub().PutState(vinIndexKey, []byte{0x00})
+}
+
+// QueryCarByVIN returns the car registered with the given VIN
+func (s *SmartContract) QueryCarByVIN(ctx contractapi.TransactionContextInterface, vin string) (*QueryResult, error) {
+	vin = normalizeVIN(vin)
+	carNumber, err := s.carNumberForVIN(ctx, vin)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if carNumber == "" {
+		return nil, newError(ErrCarNotFound, "no car with VIN %s exists", vin)
+	}
+
+	car, err := s.QueryCar(ctx, carNumber)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &QueryResult{Key: carNumber, Record: car}, nil
+}
@@ -0,0 +1,76 @@
+/*
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateVIN(t *testing.T) {
+	tests := []struct {
+		vin   string
+		valid bool
+	}{
+		{vin1, true},
+		{vin2, true},
+		{vin3, true},
+		{"1M8GDM9A1KP042788", false},
+		{"1M8GDM9AXKP04278", false},
+		{"1M8GDM9AXKP0427888", false},
+		{"IM8GDM9AXKP042788", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		err := validateVIN(tt.vin)
+
+		if tt.valid {
+			assertNoError(t, err)
+		} else {
+			assertCode(t, err, ErrInvalidArgument)
+		}
+	}
+}
+
+func TestQueryCarByVIN(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+	createCar(t, ctx, "CAR1", vin1)
+	createCar(t, ctx, "CAR2", vin2)
+
+	result, err := s.QueryCarByVIN(ctx.as(bob), vin2)
+	assertNoError(t, err)
+
+	if result.Key != "CAR2" || result.Record.VIN != vin2 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+
+	_, err = s.QueryCarByVIN(ctx.as(bob), vin3)
+	assertCode(t, err, ErrCarNotFound)
+}
+
+func TestQueryCarByVIN_LowerCase(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+	createCar(t, ctx, "CAR2", vin2)
+
+	result, err := s.QueryCarByVIN(ctx.as(bob), strings.ToLower(vin2))
+	assertNoError(t, err)
+
+	if result.Key != "CAR2" {
+		t.Fatalf("unexpected result %+v", result)
+	}
+}
+
+func TestQueryCarByVIN_DanglingIndex(t *testing.T) {
+	ctx := newFakeContext()
+	s := new(SmartContract)
+	key, _ := ctx.stub.CreateCompositeKey(vinIndex, []string{vin1, "CAR1"})
+	ctx.putRaw(t, key, "\x00")
+
+	_, err := s.QueryCarByVIN(ctx.as(alice), vin1)
+	assertCode(t, err, ErrCarNotFound)
+}
@@ -0,0 +1,405 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// ==== Auctions ==============================================================================
+// An auction puts a marble up for sale to the highest bidder. Only the owner of a marble may
+// put it up for auction. While the auction is open the marble is locked: transferMarble and
+// delete refuse it, and transferMarblesBasedOnColor skips it. Each bid is stored under its
+// own auctionBid~marble~bidder composite key, so bids from different bidders never touch the
+// same key and do not conflict with each other. Closing times are checked against the
+// transaction timestamp, which every endorser agrees on, rather than the clock of the peer.
+// When the auction is closed the marble is handed to the winner in the same transaction.
+// ============================================================================================
+
+const (
+	auctionIndex = "auction~marble"
+	bidIndex     = "auctionBid~marble~bidder"
+
+	auctionOpen   = "open"
+	auctionClosed = "closed"
+)
+
+type auction struct {
+	ObjectType   string `json:"docType"` //docType is used to distinguish the various types of objects in state database
+	Marble       string `json:"marble"`
+	Seller       string `json:"seller"`
+	ReservePrice int    `json:"reservePrice"`
+	CloseTime    string `json:"closeTime"` //RFC 3339
+	Status       string `json:"status"`
+	Winner       string `json:"winner,omitempty"`
+	WinningBid   int    `json:"winningBid,omitempty"`
+}
+
+type auctionBid struct {
+	ObjectType string    `json:"docType"`
+	Marble     string    `json:"marble"`
+	Bidder     string    `json:"bidder"`
+	Amount     int       `json:"amount"`
+	TxID       string    `json:"txId"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// getTxTime returns the transaction timestamp
+func getTxTime(stub shim.ChaincodeStubInterface) (time.Time, error) {
+	ts, err := stub.GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(ts.Seconds, int64(ts.Nanos)).UTC(), nil
+}
+
+// getAuctionState reads the auction of a marble, returning nil if the marble was never auctioned
+func getAuctionState(stub shim.ChaincodeStubInterface, marbleName string) (*auction, error) {
+	auctionKey, err := stub.CreateCompositeKey(auctionIndex, []string{marbleName})
+	if err != nil {
+		return nil, err
+	}
+	auctionAsBytes, err := stub.GetState(auctionKey)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get auction: %s", err.Error())
+	} else if auctionAsBytes == nil {
+		return nil, nil
+	}
+
+	auctionJSON := &auction{}
+	err = json.Unmarshal(auctionAsBytes, auctionJSON)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decode auction of %s: %s", marbleName, err.Error())
+	}
+	return auctionJSON, nil
+}
+
+func putAuctionState(stub shim.ChaincodeStubInterface, auctionJSON *auction) error {
+	auctionKey, err := stub.CreateCompositeKey(auctionIndex, []string{auctionJSON.Marble})
+	if err != nil {
+		return err
+	}
+	auctionAsBytes, err := json.Marshal(auctionJSON)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(auctionKey, auctionAsBytes)
+}
+
+// checkNotAuctioned returns an error if the marble is locked by an open auction
+func checkNotAuctioned(stub shim.ChaincodeStubInterface, marbleName string) error {
+	auctionJSON, err := getAuctionState(stub, marbleName)
+	if err != nil {
+		return err
+	}
+	if auctionJSON != nil && auctionJSON.Status == auctionOpen {
+		return newError(codeMarbleLocked, "Marble %s is locked by an open auction", marbleName)
+	}
+	return nil
+}
+
+// getBids returns the bids placed in the open auction of a marble
+func getBids(stub shim.ChaincodeStubInterface, marbleName string) ([]auctionBid, error) {
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(bidIndex, []string{marbleName})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	bids := []auctionBid{}
+	for resultsIterator.HasNext() {
+		responseRange, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		var bidJSON auctionBid
+		err = json.Unmarshal(responseRange.Value, &bidJSON)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to decode bid %s: %s", responseRange.Key, err.Error())
+		}
+		bids = append(bids, bidJSON)
+	}
+	return bids, nil
+}
+
+// ============================================================
+// openAuction - put a marble up for auction until closeTime. The seller must
+// be the owner of the marble
+// ============================================================
+func (t *SimpleChaincode) openAuction(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+
+	//   0          1       2              3
+	// "marble1", "tom", "100", "2020-01-31T17:00:00Z"
+	if len(args) != 4 {
+		return failure(codeInvalidArgument, "Incorrect number of arguments. Expecting 4")
+	}
+
+	marbleName := args[0]
+	seller := strings.ToLower(args[1])
+	if len(seller) <= 0 {
+		return failure(codeInvalidArgument, "2nd argument must be a non-empty string")
+	}
+	reservePrice, err := strconv.Atoi(args[2])
+	if err != nil || reservePrice < 0 {
+		return failure(codeInvalidArgument, "3rd argument must be a non-negative numeric string")
+	}
+	closeTime, err := time.Parse(time.RFC3339, args[3])
+	if err != nil {
+		return failure(codeInvalidArgument, "4th argument must be an RFC 3339 time")
+	}
+	fmt.Println("- start openAuction ", marbleName, seller, reservePrice, args[3])
+
+	marbleAsBytes, err := stub.GetState(marbleName)
+	if err != nil {
+		return failure(codeInternal, "Failed to get marble: %s", err.Error())
+	} else if marbleAsBytes == nil {
+		return failure(codeMarbleNotFound, "Marble does not exist: %s", marbleName)
+	}
+	marbleJSON := marble{}
+	err = json.Unmarshal(marbleAsBytes, &marbleJSON)
+	if err != nil {
+		return errorResponse(err)
+	}
+	if marbleJSON.Owner != seller {
+		return failure(codeNotOwner, "Marble %s is not owned by %s", marbleName, seller)
+	}
+
+	err = checkNotAuctioned(stub, marbleName)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	now, err := getTxTime(stub)
+	if err != nil {
+		return errorResponse(err)
+	}
+	if !closeTime.After(now) {
+		return failure(codeInvalidArgument, "Close time must be after the transaction time %s", now.Format(time.RFC3339))
+	}
+
+	auctionJSON := &auction{
+		ObjectType:   "auction",
+		Marble:       marbleName,
+		Seller:       seller,
+		ReservePrice: reservePrice,
+		CloseTime:    closeTime.UTC().Format(time.RFC3339),
+		Status:       auctionOpen,
+	}
+	err = putAuctionState(stub, auctionJSON)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	fmt.Println("- end openAuction")
+	return success(nil)
+}
+
+// ============================================================
+// bid - place or raise a bid in the open auction of a marble
+// ============================================================
+func (t *SimpleChaincode) bid(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+
+	//   0          1        2
+	// "marble1", "jerry", "120"
+	if len(args) != 3 {
+		return failure(codeInvalidArgument, "Incorrect number of arguments. Expecting 3")
+	}
+
+	marbleName := args[0]
+	bidder := strings.ToLower(args[1])
+	if len(bidder) <= 0 {
+		return failure(codeInvalidArgument, "2nd argument must be a non-empty string")
+	}
+	amount, err := strconv.Atoi(args[2])
+	if err != nil || amount <= 0 {
+		return failure(codeInvalidArgument, "3rd argument must be a positive numeric string")
+	}
+	fmt.Println("- start bid ", marbleName, bidder, amount)
+
+	auctionJSON, err := getAuctionState(stub, marbleName)
+	if err != nil {
+		return errorResponse(err)
+	} else if auctionJSON == nil || auctionJSON.Status != auctionOpen {
+		return failure(codeAuctionNotFound, "No open auction for marble: %s", marbleName)
+	}
+
+	now, err := getTxTime(stub)
+	if err != nil {
+		return errorResponse(err)
+	}
+	closeTime, _ := time.Parse(time.RFC3339, auctionJSON.CloseTime)
+	if !now.Before(closeTime) {
+		return failure(codeAuctionState, "The auction for %s closed at %s", marbleName, auctionJSON.CloseTime)
+	}
+
+	if bidder == auctionJSON.Seller {
+		return failure(codeInvalidArgument, "The seller may not bid on their own marble")
+	}
+	if amount < auctionJSON.ReservePrice {
+		return failure(codeInvalidArgument, "Bid must be at least the reserve price of %d", auctionJSON.ReservePrice)
+	}
+
+	bidKey, err := stub.CreateCompositeKey(bidIndex, []string{marbleName, bidder})
+	if err != nil {
+		return errorResponse(err)
+	}
+	previousAsBytes, err := stub.GetState(bidKey)
+	if err != nil {
+		return failure(codeInternal, "Failed to get bid: %s", err.Error())
+	} else if previousAsBytes != nil {
+		previous := auctionBid{}
+		err = json.Unmarshal(previousAsBytes, &previous)
+		if err != nil {
+			return errorResponse(err)
+		}
+		if amount <= previous.Amount {
+			return failure(codeInvalidArgument, "Bid must be higher than your previous bid of %d", previous.Amount)
+		}
+	}
+
+	bidJSON := auctionBid{
+		ObjectType: "auctionBid",
+		Marble:     marbleName,
+		Bidder:     bidder,
+		Amount:     amount,
+		TxID:       stub.GetTxID(),
+		Timestamp:  now,
+	}
+	bidAsBytes, err := json.Marshal(bidJSON)
+	if err != nil {
+		return errorResponse(err)
+	}
+	err = stub.PutState(bidKey, bidAsBytes)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	fmt.Println("- end bid")
+	return success(nil)
+}
+
+// ============================================================
+// closeAuction - close the auction of a marble once its close time has passed.
+// The highest bid at or above the reserve price wins, with ties going to the
+// earliest bid, and the marble is transferred to the winner.
+// ============================================================
+func (t *SimpleChaincode) closeAuction(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+
+	//   0
+	// "marble1"
+	if len(args) != 1 {
+		return failure(codeInvalidArgument, "Incorrect number of arguments. Expecting 1")
+	}
+
+	marbleName := args[0]
+	fmt.Println("- start closeAuction ", marbleName)
+
+	auctionJSON, err := getAuctionState(stub, marbleName)
+	if err != nil {
+		return errorResponse(err)
+	} else if auctionJSON == nil || auctionJSON.Status != auctionOpen {
+		return failure(codeAuctionNotFound, "No open auction for marble: %s", marbleName)
+	}
+
+	now, err := getTxTime(stub)
+	if err != nil {
+		return errorResponse(err)
+	}
+	closeTime, _ := time.Parse(time.RFC3339, auctionJSON.CloseTime)
+	if now.Before(closeTime) {
+		return failure(codeAuctionState, "The auction for %s is open until %s", marbleName, auctionJSON.CloseTime)
+	}
+
+	bids, err := getBids(stub, marbleName)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	var winner *auctionBid
+	for i := range bids {
+		b := &bids[i]
+		if b.Amount < auctionJSON.ReservePrice {
+			continue
+		}
+		if winner == nil || b.Amount > winner.Amount || (b.Amount == winner.Amount && b.Timestamp.Before(winner.Timestamp)) {
+			winner = b
+		}
+	}
+
+	// the bids are settled, remove them so the marble can be auctioned again
+	for _, b := range bids {
+		bidKey, err := stub.CreateCompositeKey(bidIndex, []string{marbleName, b.Bidder})
+		if err != nil {
+			return errorResponse(err)
+		}
+		err = stub.DelState(bidKey)
+		if err != nil {
+			return failure(codeInternal, "Failed to delete state: %s", err.Error())
+		}
+	}
+
+	auctionJSON.Status = auctionClosed
+	if winner != nil {
+		auctionJSON.Winner = winner.Bidder
+		auctionJSON.WinningBid = winner.Amount
+
+		// The auction is still open in state until the transaction commits, so
+		// transferMarble would refuse the marble; the owner is set directly instead
+		err = setMarbleOwner(stub, marbleName, winner.Bidder)
+		if err != nil {
+			return errorResponse(err)
+		}
+	}
+	err = putAuctionState(stub, auctionJSON)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	fmt.Println("- end closeAuction")
+	auctionAsBytes, _ := json.Marshal(auctionJSON)
+	return success(json.RawMessage(auctionAsBytes))
+}
+
+// ============================================================
+// getAuction - read the auction of a marble along with its open bids
+// ============================================================
+func (t *SimpleChaincode) getAuction(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+
+	//   0
+	// "marble1"
+	if len(args) != 1 {
+		return failure(codeInvalidArgument, "Incorrect number of arguments. Expecting 1")
+	}
+
+	marbleName := args[0]
+	auctionJSON, err := getAuctionState(stub, marbleName)
+	if err != nil {
+		return errorResponse(err)
+	} else if auctionJSON == nil {
+		return failure(codeAuctionNotFound, "No auction for marble: %s", marbleName)
+	}
+
+	bids, err := getBids(stub, marbleName)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	response := struct {
+		*auction
+		Bids []auctionBid `json:"bids"`
+	}{auctionJSON, bids}
+	responseAsBytes, err := json.Marshal(response)
+	if err != nil {
+		return errorResponse(err)
+	}
+	return success(json.RawMessage(responseAsBytes))
+}
@@ -0,0 +1,205 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// auctionStart is the transaction time the auction tests open their auctions at
+var auctionStart = time.Date(2020, 1, 31, 12, 0, 0, 0, time.UTC)
+
+var txCount int
+
+// callAt runs fn in a transaction timestamped at, and decodes the response envelope
+func callAt(t *testing.T, stub *fakeStub, at time.Time, fn func(shim.ChaincodeStubInterface, []string) pb.Response, args ...string) response {
+	txCount++
+	txID := "tx" + strconv.Itoa(txCount)
+	stub.MockTransactionStart(txID)
+	stub.TxTimestamp.Seconds = at.Unix()
+	stub.TxTimestamp.Nanos = int32(at.Nanosecond())
+	res := fn(stub, args)
+	stub.MockTransactionEnd(txID)
+
+	var r response
+	body := res.Payload
+	if res.Status != shim.OK {
+		body = []byte(res.Message)
+	}
+	if err := json.Unmarshal(body, &r); err != nil {
+		t.Fatalf("failed to decode response %q: %s", body, err)
+	}
+	if r.OK != (res.Status == shim.OK) {
+		t.Fatalf("response envelope %q does not match status %d", body, res.Status)
+	}
+	return r
+}
+
+// call runs fn in a transaction timestamped at auctionStart
+func call(t *testing.T, stub *fakeStub, fn func(shim.ChaincodeStubInterface, []string) pb.Response, args ...string) response {
+	return callAt(t, stub, auctionStart, fn, args...)
+}
+
+func expectOK(t *testing.T, r response) {
+	t.Helper()
+	if !r.OK {
+		t.Fatalf("expected success, got %s: %s", r.Code, r.Message)
+	}
+}
+
+func expectCode(t *testing.T, r response, code errorCode) {
+	t.Helper()
+	if r.OK || r.Code != code {
+		t.Fatalf("expected %s, got %+v", code, r)
+	}
+}
+
+// newMarbleStub returns a stub holding marble1, a blue marble owned by tom
+func newMarbleStub(t *testing.T) (*SimpleChaincode, *fakeStub) {
+	cc := new(SimpleChaincode)
+	stub := newFakeStub(cc)
+	expectOK(t, call(t, stub, cc.initMarble, "marble1", "blue", "35", "tom"))
+	return cc, stub
+}
+
+func readOwner(t *testing.T, cc *SimpleChaincode, stub *fakeStub, marbleName string) string {
+	r := call(t, stub, cc.readMarble, marbleName)
+	expectOK(t, r)
+	data, _ := json.Marshal(r.Data)
+	var m marble
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatalf("failed to decode marble: %s", err)
+	}
+	return m.Owner
+}
+
+func openTestAuction(t *testing.T, cc *SimpleChaincode, stub *fakeStub, reservePrice string) time.Time {
+	closeTime := auctionStart.Add(time.Hour)
+	expectOK(t, call(t, stub, cc.openAuction, "marble1", "tom", reservePrice, closeTime.Format(time.RFC3339)))
+	return closeTime
+}
+
+func TestOpenAuction(t *testing.T) {
+	cc, stub := newMarbleStub(t)
+	closeTime := auctionStart.Add(time.Hour).Format(time.RFC3339)
+
+	expectCode(t, call(t, stub, cc.openAuction, "marble1", "jerry", "100", closeTime), codeNotOwner)
+	expectCode(t, call(t, stub, cc.openAuction, "marble9", "tom", "100", closeTime), codeMarbleNotFound)
+	expectCode(t, call(t, stub, cc.openAuction, "marble1", "tom", "100", auctionStart.Format(time.RFC3339)), codeInvalidArgument)
+	expectCode(t, call(t, stub, cc.openAuction, "marble1", "tom", "-1", closeTime), codeInvalidArgument)
+
+	// the owner is matched regardless of case, as owners are stored in lower case
+	expectOK(t, call(t, stub, cc.openAuction, "marble1", "Tom", "100", closeTime))
+	expectCode(t, call(t, stub, cc.openAuction, "marble1", "tom", "100", closeTime), codeMarbleLocked)
+}
+
+func TestBid(t *testing.T) {
+	cc, stub := newMarbleStub(t)
+	expectCode(t, call(t, stub, cc.bid, "marble1", "jerry", "120"), codeAuctionNotFound)
+
+	closeTime := openTestAuction(t, cc, stub, "100")
+
+	expectCode(t, call(t, stub, cc.bid, "marble1", "tom", "120"), codeInvalidArgument)
+	expectCode(t, call(t, stub, cc.bid, "marble1", "jerry", "99"), codeInvalidArgument)
+	expectOK(t, call(t, stub, cc.bid, "marble1", "jerry", "120"))
+	expectCode(t, call(t, stub, cc.bid, "marble1", "jerry", "120"), codeInvalidArgument)
+	expectOK(t, call(t, stub, cc.bid, "marble1", "jerry", "130"))
+	expectCode(t, callAt(t, stub, closeTime, cc.bid, "marble1", "alice", "200"), codeAuctionState)
+
+	r := call(t, stub, cc.getAuction, "marble1")
+	expectOK(t, r)
+	data, _ := json.Marshal(r.Data)
+	var result struct {
+		Status string       `json:"status"`
+		Bids   []auctionBid `json:"bids"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		t.Fatalf("failed to decode auction: %s", err)
+	}
+	if result.Status != auctionOpen || len(result.Bids) != 1 || result.Bids[0].Amount != 130 {
+		t.Fatalf("unexpected auction %s", data)
+	}
+}
+
+func TestCloseAuction(t *testing.T) {
+	cc, stub := newMarbleStub(t)
+	closeTime := openTestAuction(t, cc, stub, "100")
+	expectOK(t, call(t, stub, cc.bid, "marble1", "jerry", "120"))
+	expectOK(t, call(t, stub, cc.bid, "marble1", "alice", "150"))
+
+	expectCode(t, callAt(t, stub, closeTime.Add(-time.Second), cc.closeAuction, "marble1"), codeAuctionState)
+
+	r := callAt(t, stub, closeTime, cc.closeAuction, "marble1")
+	expectOK(t, r)
+	data, _ := json.Marshal(r.Data)
+	var closed auction
+	if err := json.Unmarshal(data, &closed); err != nil {
+		t.Fatalf("failed to decode auction: %s", err)
+	}
+	if closed.Status != auctionClosed || closed.Winner != "alice" || closed.WinningBid != 150 {
+		t.Fatalf("unexpected auction %s", data)
+	}
+	if owner := readOwner(t, cc, stub, "marble1"); owner != "alice" {
+		t.Fatalf("expected alice to own marble1, got %s", owner)
+	}
+
+	// the bids are settled, and the winner is found through the owner index
+	bids, err := getBids(stub, "marble1")
+	if err != nil || len(bids) != 0 {
+		t.Fatalf("expected no bids left, got %v %v", bids, err)
+	}
+	ownerKey, _ := stub.CreateCompositeKey("owner~name", []string{"alice", "marble1"})
+	if stub.State[ownerKey] == nil {
+		t.Fatal("expected marble1 in the owner index of alice")
+	}
+
+	expectCode(t, callAt(t, stub, closeTime, cc.closeAuction, "marble1"), codeAuctionNotFound)
+}
+
+func TestCloseAuction_NoWinner(t *testing.T) {
+	cc, stub := newMarbleStub(t)
+	closeTime := openTestAuction(t, cc, stub, "100")
+
+	r := callAt(t, stub, closeTime, cc.closeAuction, "marble1")
+	expectOK(t, r)
+	if owner := readOwner(t, cc, stub, "marble1"); owner != "tom" {
+		t.Fatalf("expected tom to keep marble1, got %s", owner)
+	}
+}
+
+func TestCloseAuction_TieBreak(t *testing.T) {
+	cc, stub := newMarbleStub(t)
+	closeTime := openTestAuction(t, cc, stub, "100")
+
+	// jerry bids first, but alice's bid sorts first in the bid index
+	expectOK(t, callAt(t, stub, auctionStart.Add(time.Minute), cc.bid, "marble1", "jerry", "150"))
+	expectOK(t, callAt(t, stub, auctionStart.Add(2*time.Minute), cc.bid, "marble1", "alice", "150"))
+
+	expectOK(t, callAt(t, stub, closeTime, cc.closeAuction, "marble1"))
+	if owner := readOwner(t, cc, stub, "marble1"); owner != "jerry" {
+		t.Fatalf("expected the earliest bid to win, got %s", owner)
+	}
+}
+
+func TestAuction_LocksMarble(t *testing.T) {
+	cc, stub := newMarbleStub(t)
+	closeTime := openTestAuction(t, cc, stub, "100")
+
+	expectCode(t, call(t, stub, cc.transferMarble, "marble1", "jerry"), codeMarbleLocked)
+	expectCode(t, call(t, stub, cc.delete, "marble1"), codeMarbleLocked)
+	if owner := readOwner(t, cc, stub, "marble1"); owner != "tom" {
+		t.Fatalf("expected tom to keep marble1, got %s", owner)
+	}
+
+	expectOK(t, callAt(t, stub, closeTime, cc.closeAuction, "marble1"))
+	expectOK(t, call(t, stub, cc.transferMarble, "marble1", "jerry"))
+	expectOK(t, call(t, stub, cc.delete, "marble1"))
+}
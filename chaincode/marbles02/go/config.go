@@ -0,0 +1,129 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// ==== Validation config =====================================================================
+// New marbles are checked against a validation config: the colors a marble may have, the
+// range of sizes, and a regular expression its name must match. The config is passed as the
+// only argument of Init when the chaincode is instantiated or upgraded, and is kept in state
+// under the config~name composite key. Until a config is set the defaults below apply.
+//
+//   peer chaincode instantiate -C myc1 -n marbles -v 1.0 -c '{"Args":["init","{\"colors\":[\"blue\",\"red\"],\"minSize\":1,\"maxSize\":100,\"namePattern\":\"^marble[0-9]+$\"}"]}'
+// ============================================================================================
+
+const configIndex = "config~name"
+
+type marbleConfig struct {
+	Colors      []string `json:"colors"` //an empty list allows any color
+	MinSize     int      `json:"minSize"`
+	MaxSize     int      `json:"maxSize"`
+	NamePattern string   `json:"namePattern"`
+}
+
+// defaultConfig allows any color and limits sizes and name characters
+var defaultConfig = marbleConfig{
+	Colors:      []string{},
+	MinSize:     1,
+	MaxSize:     1000,
+	NamePattern: "^[A-Za-z0-9_.-]{1,64}$",
+}
+
+// parseConfig decodes and checks a validation config. Colors are stored in lower case, like
+// the colors of marbles
+func parseConfig(configJSON string) (*marbleConfig, error) {
+	config := defaultConfig
+	err := json.Unmarshal([]byte(configJSON), &config)
+	if err != nil {
+		return nil, newError(codeInvalidArgument, "Failed to decode config: %s", err.Error())
+	}
+	if config.MinSize > config.MaxSize {
+		return nil, newError(codeInvalidArgument, "minSize %d is greater than maxSize %d", config.MinSize, config.MaxSize)
+	}
+	if _, err := regexp.Compile(config.NamePattern); err != nil {
+		return nil, newError(codeInvalidArgument, "namePattern is not a valid regular expression: %s", err.Error())
+	}
+	colors := []string{}
+	for _, color := range config.Colors {
+		if color == "" {
+			return nil, newError(codeInvalidArgument, "colors must not be empty strings")
+		}
+		colors = append(colors, strings.ToLower(color))
+	}
+	sort.Strings(colors)
+	config.Colors = colors
+	return &config, nil
+}
+
+// getConfigState reads the validation config, returning the defaults if none was set
+func getConfigState(stub shim.ChaincodeStubInterface) (*marbleConfig, error) {
+	configKey, err := stub.CreateCompositeKey(configIndex, []string{"validation"})
+	if err != nil {
+		return nil, err
+	}
+	configAsBytes, err := stub.GetState(configKey)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get config: %s", err.Error())
+	} else if configAsBytes == nil {
+		config := defaultConfig
+		return &config, nil
+	}
+	return parseConfig(string(configAsBytes))
+}
+
+// putConfig stores the validation config
+func putConfig(stub shim.ChaincodeStubInterface, config *marbleConfig) error {
+	configKey, err := stub.CreateCompositeKey(configIndex, []string{"validation"})
+	if err != nil {
+		return err
+	}
+	configAsBytes, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(configKey, configAsBytes)
+}
+
+// validate checks a new marble against the config
+func (c *marbleConfig) validate(name string, color string, size int) error {
+	if matched, _ := regexp.MatchString(c.NamePattern, name); !matched {
+		return newError(codeInvalidMarble, "Marble name %q does not match %s", name, c.NamePattern)
+	}
+	if len(c.Colors) > 0 {
+		i := sort.SearchStrings(c.Colors, color)
+		if i == len(c.Colors) || c.Colors[i] != color {
+			return newError(codeInvalidMarble, "Color %s is not one of %s", color, strings.Join(c.Colors, ", "))
+		}
+	}
+	if size < c.MinSize || size > c.MaxSize {
+		return newError(codeInvalidMarble, "Size %d is not between %d and %d", size, c.MinSize, c.MaxSize)
+	}
+	return nil
+}
+
+// ===========================================================================================
+// getConfig returns the marble validation config in effect
+// ===========================================================================================
+func (t *SimpleChaincode) getConfig(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 0 {
+		return failure(codeInvalidArgument, "Incorrect number of arguments. Expecting 0")
+	}
+
+	config, err := getConfigState(stub)
+	if err != nil {
+		return errorResponse(err)
+	}
+	return success(config)
+}
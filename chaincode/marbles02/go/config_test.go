@@ -0,0 +1,155 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+)
+
+const testConfig = `{"colors":["Red","blue"],"minSize":10,"maxSize":50,"namePattern":"^marble[0-9]+$"}`
+
+// initWithConfig runs Init with the given arguments and decodes the response envelope
+func initWithConfig(t *testing.T, stub *fakeStub, args ...string) response {
+	initArgs := [][]byte{[]byte("init")}
+	for _, arg := range args {
+		initArgs = append(initArgs, []byte(arg))
+	}
+	res := stub.MockInit("init", initArgs)
+
+	var r response
+	body := res.Payload
+	if res.Status != shim.OK {
+		body = []byte(res.Message)
+	}
+	if err := json.Unmarshal(body, &r); err != nil {
+		t.Fatalf("failed to decode response %q: %s", body, err)
+	}
+	return r
+}
+
+func TestParseConfig(t *testing.T) {
+	config, err := parseConfig(testConfig)
+	if err != nil {
+		t.Fatalf("expected the config to be accepted, got %s", err)
+	}
+	expected := &marbleConfig{Colors: []string{"blue", "red"}, MinSize: 10, MaxSize: 50, NamePattern: "^marble[0-9]+$"}
+	if !reflect.DeepEqual(config, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, config)
+	}
+
+	// fields left out keep their defaults
+	config, err = parseConfig(`{"colors":["blue"]}`)
+	if err != nil || config.MinSize != defaultConfig.MinSize || config.MaxSize != defaultConfig.MaxSize || config.NamePattern != defaultConfig.NamePattern {
+		t.Fatalf("expected the defaults to apply, got %+v %v", config, err)
+	}
+
+	rejected := []string{
+		`not a config`,
+		`{"minSize":10,"maxSize":5}`,
+		`{"namePattern":"marble[0-9"}`,
+		`{"colors":["blue",""]}`,
+	}
+	for _, configJSON := range rejected {
+		_, err := parseConfig(configJSON)
+		if e, ok := err.(*marbleError); !ok || e.Code != codeInvalidArgument {
+			t.Fatalf("expected %s to be rejected, got %v", configJSON, err)
+		}
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	config, _ := parseConfig(testConfig)
+
+	if err := config.validate("marble1", "red", 10); err != nil {
+		t.Fatalf("expected marble1 to be valid, got %s", err)
+	}
+
+	tests := []struct {
+		name  string
+		color string
+		size  int
+	}{
+		{"marble1", "green", 20},   // color not allowed
+		{"marble1", "blue", 9},     // below minSize
+		{"marble1", "blue", 51},    // above maxSize
+		{"marble-1", "blue", 20},   // name does not match the pattern
+		{"xmarble1", "blue", 20},   // the pattern is anchored
+		{"marble1x", "blue", 20},   // at both ends
+		{"marble1", "bluered", 20}, // not a prefix match
+	}
+	for _, tt := range tests {
+		err := config.validate(tt.name, tt.color, tt.size)
+		if e, ok := err.(*marbleError); !ok || e.Code != codeInvalidMarble {
+			t.Fatalf("expected %+v to be rejected, got %v", tt, err)
+		}
+	}
+}
+
+func TestInit_Config(t *testing.T) {
+	cc := new(SimpleChaincode)
+	stub := newFakeStub(cc)
+
+	// until a config is set the defaults apply
+	r := call(t, stub, cc.getConfig)
+	expectOK(t, r)
+	data, _ := json.Marshal(r.Data)
+	var config marbleConfig
+	if err := json.Unmarshal(data, &config); err != nil || !reflect.DeepEqual(config, defaultConfig) {
+		t.Fatalf("expected the default config, got %s", data)
+	}
+
+	expectCode(t, initWithConfig(t, stub, `{"minSize":10,"maxSize":5}`), codeInvalidArgument)
+	expectCode(t, initWithConfig(t, stub, testConfig, testConfig), codeInvalidArgument)
+
+	r = initWithConfig(t, stub, testConfig)
+	expectOK(t, r)
+
+	r = call(t, stub, cc.getConfig)
+	expectOK(t, r)
+	data, _ = json.Marshal(r.Data)
+	if err := json.Unmarshal(data, &config); err != nil || !reflect.DeepEqual(config.Colors, []string{"blue", "red"}) || config.MaxSize != 50 {
+		t.Fatalf("expected the stored config, got %s", data)
+	}
+
+	expectCode(t, call(t, stub, cc.initMarble, "marble1", "green", "20", "tom"), codeInvalidMarble)
+	expectCode(t, call(t, stub, cc.initMarble, "marble1", "blue", "60", "tom"), codeInvalidMarble)
+	expectCode(t, call(t, stub, cc.initMarble, "marble_1", "blue", "20", "tom"), codeInvalidMarble)
+	expectOK(t, call(t, stub, cc.initMarble, "marble1", "RED", "20", "tom"))
+
+	// an upgrade without a config keeps the stored one
+	expectOK(t, initWithConfig(t, stub))
+	expectCode(t, call(t, stub, cc.initMarble, "marble2", "green", "20", "tom"), codeInvalidMarble)
+}
+
+func TestResponseEnvelope(t *testing.T) {
+	tests := []struct {
+		res      pb.Response
+		status   int32
+		envelope string
+	}{
+		{success(map[string]int{"size": 35}), shim.OK, `{"ok":true,"data":{"size":35}}`},
+		{success(json.RawMessage(`[1,2]`)), shim.OK, `{"ok":true,"data":[1,2]}`},
+		{success(nil), shim.OK, `{"ok":true}`},
+		{failure(codeMarbleNotFound, "Marble does not exist: %s", "marble1"), shim.ERROR, `{"ok":false,"code":"MARBLE_NOT_FOUND","message":"Marble does not exist: marble1"}`},
+		{errorResponse(newError(codeInvalidMarble, "Size %d is too big", 99)), shim.ERROR, `{"ok":false,"code":"INVALID_MARBLE","message":"Size 99 is too big"}`},
+		{errorResponse(errors.New("state unavailable")), shim.ERROR, `{"ok":false,"code":"INTERNAL","message":"state unavailable"}`},
+	}
+	for _, tt := range tests {
+		// a failure carries the envelope as its message, so the peer still rejects it
+		body := string(tt.res.Payload)
+		if tt.res.Status != shim.OK {
+			body = tt.res.Message
+		}
+		if tt.res.Status != tt.status || body != tt.envelope {
+			t.Fatalf("expected %d %s, got %d %s", tt.status, tt.envelope, tt.res.Status, body)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// fakeStub is an in-memory stub built on shimtest.MockStub. It fills in the
+// parts the mock leaves unimplemented: key history and paginated range,
+// composite key and rich queries
+type fakeStub struct {
+	*shimtest.MockStub
+	History map[string][]*queryresult.KeyModification
+}
+
+func newFakeStub(cc shim.Chaincode) *fakeStub {
+	return &fakeStub{
+		MockStub: shimtest.NewMockStub("marbles", cc),
+		History:  map[string][]*queryresult.KeyModification{},
+	}
+}
+
+func (s *fakeStub) PutState(key string, value []byte) error {
+	if err := s.MockStub.PutState(key, value); err != nil {
+		return err
+	}
+	s.History[key] = append(s.History[key], &queryresult.KeyModification{TxId: s.TxID, Value: value, Timestamp: s.TxTimestamp})
+	return nil
+}
+
+func (s *fakeStub) DelState(key string) error {
+	if err := s.MockStub.DelState(key); err != nil {
+		return err
+	}
+	s.History[key] = append(s.History[key], &queryresult.KeyModification{TxId: s.TxID, Timestamp: s.TxTimestamp, IsDelete: true})
+	return nil
+}
+
+// GetHistoryForKey returns the changes to key newest first, like the peer
+func (s *fakeStub) GetHistoryForKey(key string) (shim.HistoryQueryIteratorInterface, error) {
+	mods := []*queryresult.KeyModification{}
+	for i := len(s.History[key]) - 1; i >= 0; i-- {
+		mods = append(mods, s.History[key][i])
+	}
+	return &historyIterator{mods: mods}, nil
+}
+
+// simpleKeys returns the non-composite keys in order, as a range query over
+// the whole key space would on a peer
+func (s *fakeStub) simpleKeys() []string {
+	keys := []string{}
+	for elem := s.Keys.Front(); elem != nil; elem = elem.Next() {
+		key := elem.Value.(string)
+		if !strings.HasPrefix(key, "\x00") {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// page returns up to pageSize of keys that sort after bookmark, along with
+// the bookmark for the following page
+func (s *fakeStub) page(keys []string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *pb.QueryResponseMetadata) {
+	kvs := []*queryresult.KV{}
+	for _, key := range keys {
+		if bookmark != "" && key <= bookmark {
+			continue
+		}
+		if int32(len(kvs)) == pageSize {
+			break
+		}
+		kvs = append(kvs, &queryresult.KV{Key: key, Value: s.State[key]})
+	}
+
+	next := ""
+	if len(kvs) > 0 {
+		next = kvs[len(kvs)-1].Key
+	}
+	return &stateIterator{kvs: kvs}, &pb.QueryResponseMetadata{FetchedRecordsCount: int32(len(kvs)), Bookmark: next}
+}
+
+func (s *fakeStub) GetStateByPartialCompositeKeyWithPagination(objectType string, attributes []string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *pb.QueryResponseMetadata, error) {
+	prefix, err := s.CreateCompositeKey(objectType, attributes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keys := []string{}
+	for elem := s.Keys.Front(); elem != nil; elem = elem.Next() {
+		if key := elem.Value.(string); strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	it, metadata := s.page(keys, pageSize, bookmark)
+	return it, metadata, nil
+}
+
+func (s *fakeStub) GetStateByRangeWithPagination(startKey, endKey string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *pb.QueryResponseMetadata, error) {
+	keys := []string{}
+	for _, key := range s.simpleKeys() {
+		if (startKey == "" || key >= startKey) && (endKey == "" || key < endKey) {
+			keys = append(keys, key)
+		}
+	}
+	it, metadata := s.page(keys, pageSize, bookmark)
+	return it, metadata, nil
+}
+
+// GetQueryResultWithPagination supports selectors made of $eq conditions,
+// which is all the tests use
+func (s *fakeStub) GetQueryResultWithPagination(query string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *pb.QueryResponseMetadata, error) {
+	var q couchQuery
+	if err := json.Unmarshal([]byte(query), &q); err != nil {
+		return nil, nil, err
+	}
+
+	keys := []string{}
+	for _, key := range s.simpleKeys() {
+		var doc map[string]interface{}
+		if err := json.Unmarshal(s.State[key], &doc); err != nil {
+			continue
+		}
+		match := true
+		for field, condition := range q.Selector {
+			if value, ok := condition["$eq"]; !ok || doc[field] != value {
+				match = false
+				break
+			}
+		}
+		if match {
+			keys = append(keys, key)
+		}
+	}
+	it, metadata := s.page(keys, pageSize, bookmark)
+	return it, metadata, nil
+}
+
+type stateIterator struct {
+	kvs []*queryresult.KV
+}
+
+func (it *stateIterator) HasNext() bool { return len(it.kvs) > 0 }
+
+func (it *stateIterator) Next() (*queryresult.KV, error) {
+	if len(it.kvs) == 0 {
+		return nil, errors.New("no more results")
+	}
+	kv := it.kvs[0]
+	it.kvs = it.kvs[1:]
+	return kv, nil
+}
+
+func (it *stateIterator) Close() error { return nil }
+
+type historyIterator struct {
+	mods []*queryresult.KeyModification
+}
+
+func (it *historyIterator) HasNext() bool { return len(it.mods) > 0 }
+
+func (it *historyIterator) Next() (*queryresult.KeyModification, error) {
+	if len(it.mods) == 0 {
+		return nil, errors.New("no more results")
+	}
+	mod := it.mods[0]
+	it.mods = it.mods[1:]
+	return mod, nil
+}
+
+func (it *historyIterator) Close() error { return nil }
@@ -10,19 +10,39 @@
 // peer chaincode invoke -C myc1 -n marbles -c '{"Args":["initMarble","marble3","blue","70","tom"]}'
 // peer chaincode invoke -C myc1 -n marbles -c '{"Args":["transferMarble","marble2","jerry"]}'
 // peer chaincode invoke -C myc1 -n marbles -c '{"Args":["transferMarblesBasedOnColor","blue","jerry"]}'
+// peer chaincode invoke -C myc1 -n marbles -c '{"Args":["transferMarblesBasedOnColor","blue","jerry","10","true","tom"]}'
 // peer chaincode invoke -C myc1 -n marbles -c '{"Args":["delete","marble1"]}'
 
+// Every function returns a JSON envelope, {"ok":true,"data":...} on success and
+// {"ok":false,"code":"...","message":"..."} on failure, see response.go.
+// The marbles initMarble accepts are limited by the validation config, see config.go.
+
+// ==== Auction marbles ====
+// peer chaincode invoke -C myc1 -n marbles -c '{"Args":["openAuction","marble3","tom","100","2020-01-31T17:00:00Z"]}'
+// peer chaincode invoke -C myc1 -n marbles -c '{"Args":["bid","marble3","jerry","120"]}'
+// peer chaincode invoke -C myc1 -n marbles -c '{"Args":["closeAuction","marble3"]}'
+// peer chaincode query -C myc1 -n marbles -c '{"Args":["getAuction","marble3"]}'
+
 // ==== Query marbles ====
 // peer chaincode query -C myc1 -n marbles -c '{"Args":["readMarble","marble1"]}'
+// peer chaincode query -C myc1 -n marbles -c '{"Args":["getConfig"]}'
 // peer chaincode query -C myc1 -n marbles -c '{"Args":["getMarblesByRange","marble1","marble3"]}'
 // peer chaincode query -C myc1 -n marbles -c '{"Args":["getHistoryForMarble","marble1"]}'
+// peer chaincode query -C myc1 -n marbles -c '{"Args":["getMarblesByOwnerIndex","tom","3",""]}'
+
+// ==== Query marbles with pagination ====
+// peer chaincode query -C myc1 -n marbles -c '{"Args":["getMarblesByRangeWithPagination","marble1","marble9","3",""]}'
+// peer chaincode query -C myc1 -n marbles -c '{"Args":["getMarblesByColorWithPagination","blue","3",""]}'
+// peer chaincode query -C myc1 -n marbles -c '{"Args":["getHistoryForMarbleWithPagination","marble1","3",""]}'
+// Each page is returned as {"records":[...],"fetchedRecordsCount":3,"bookmark":"..."}. Pass the
+// bookmark back in to fetch the next page.
 
 // Rich Query (Only supported if CouchDB is used as state database):
 // peer chaincode query -C myc1 -n marbles -c '{"Args":["queryMarblesByOwner","tom"]}'
-// peer chaincode query -C myc1 -n marbles -c '{"Args":["queryMarbles","{\"selector\":{\"owner\":\"tom\"}}"]}'
+// peer chaincode query -C myc1 -n marbles -c '{"Args":["queryMarbles","{\"conditions\":[{\"field\":\"owner\",\"operator\":\"$eq\",\"value\":\"tom\"}]}"]}'
 
 // Rich Query with Pagination (Only supported if CouchDB is used as state database):
-// peer chaincode query -C myc1 -n marbles -c '{"Args":["queryMarblesWithPagination","{\"selector\":{\"owner\":\"tom\"}}","3",""]}'
+// peer chaincode query -C myc1 -n marbles -c '{"Args":["queryMarblesWithPagination","{\"conditions\":[{\"field\":\"owner\",\"operator\":\"$eq\",\"value\":\"tom\"}]}","3",""]}'
 
 // INDEXES TO SUPPORT COUCHDB RICH QUERIES
 //
@@ -33,8 +53,10 @@
 // CouchDB index JSON syntax as documented at:
 // http://docs.couchdb.org/en/2.1.1/api/database/find.html#db-index
 //
-// This marbles02 example chaincode demonstrates a packaged
-// index which you can find in META-INF/statedb/couchdb/indexes/indexOwner.json.
+// This marbles02 example chaincode demonstrates packaged indexes which you can find in
+// META-INF/statedb/couchdb/indexes: indexOwner.json, indexName.json, indexColor.json and
+// indexSizeSort.json. The rich queries of this chaincode only run when one of these indexes
+// can serve them, see query.go.
 // For deployment of chaincode to production environments, it is recommended
 // to define any indexes alongside chaincode so that the chaincode and supporting indexes
 // are deployed automatically as a unit, once the chaincode has been installed on a peer and
@@ -66,21 +88,23 @@
 // curl -i -X POST -H "Content-Type: application/json" -d "{\"index\":{\"fields\":[\"docType\",\"owner\"]},\"name\":\"indexOwner\",\"ddoc\":\"indexOwnerDoc\",\"type\":\"json\"}" http://hostname:port/myc1_marbles/_index
 //
 
+// Indexes for docType, name and docType, color are defined the same way, as indexName in
+// indexNameDoc and indexColor in indexColorDoc.
+
 // Index for docType, owner, size (descending order).
 //
 // Example curl command line to define index in the CouchDB channel_chaincode database
 // curl -i -X POST -H "Content-Type: application/json" -d "{\"index\":{\"fields\":[{\"size\":\"desc\"},{\"docType\":\"desc\"},{\"owner\":\"desc\"}]},\"ddoc\":\"indexSizeSortDoc\", \"name\":\"indexSizeSortDesc\",\"type\":\"json\"}" http://hostname:port/myc1_marbles/_index
 
-// Rich Query with index design doc and index name specified (Only supported if CouchDB is used as state database):
-//   peer chaincode query -C myc1 -n marbles -c '{"Args":["queryMarbles","{\"selector\":{\"docType\":\"marble\",\"owner\":\"tom\"}, \"use_index\":[\"_design/indexOwnerDoc\", \"indexOwner\"]}"]}'
+// Rich Query served by the owner index (Only supported if CouchDB is used as state database):
+//   peer chaincode query -C myc1 -n marbles -c '{"Args":["queryMarbles","{\"conditions\":[{\"field\":\"owner\",\"operator\":\"$eq\",\"value\":\"tom\"}]}"]}'
 
-// Rich Query with index design doc specified only (Only supported if CouchDB is used as state database):
-//   peer chaincode query -C myc1 -n marbles -c '{"Args":["queryMarbles","{\"selector\":{\"docType\":{\"$eq\":\"marble\"},\"owner\":{\"$eq\":\"tom\"},\"size\":{\"$gt\":0}},\"fields\":[\"docType\",\"owner\",\"size\"],\"sort\":[{\"size\":\"desc\"}],\"use_index\":\"_design/indexSizeSortDoc\"}"]}'
+// Rich Query sorted by the size index (Only supported if CouchDB is used as state database):
+//   peer chaincode query -C myc1 -n marbles -c '{"Args":["queryMarbles","{\"conditions\":[{\"field\":\"owner\",\"operator\":\"$eq\",\"value\":\"tom\"},{\"field\":\"size\",\"operator\":\"$gt\",\"value\":0}],\"sort\":[{\"field\":\"size\",\"direction\":\"desc\"}],\"limit\":10}"]}'
 
 package main
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"strconv"
@@ -103,6 +127,40 @@ type marble struct {
 	Owner      string `json:"owner"`
 }
 
+// queryResult is one key and its JSON value returned by a query
+type queryResult struct {
+	Key    string          `json:"Key"`
+	Record json.RawMessage `json:"Record"`
+}
+
+// historyResult is one change made to a marble
+type historyResult struct {
+	TxId      string          `json:"TxId"`
+	Value     json.RawMessage `json:"Value"`
+	Timestamp string          `json:"Timestamp"`
+	IsDelete  bool            `json:"IsDelete,string"`
+}
+
+// transferSummary reports the marbles moved by transferMarblesBasedOnColor, and the marbles
+// left with their owner because an open auction locks them. HasMore is set when more
+// marbles could have been transferred than maxCount allowed
+type transferSummary struct {
+	Color    string   `json:"color"`
+	NewOwner string   `json:"newOwner"`
+	DryRun   bool     `json:"dryRun"`
+	Marbles  []string `json:"marbles"`
+	Locked   []string `json:"locked"`
+	HasMore  bool     `json:"hasMore"`
+}
+
+// paginatedQueryResult is a page of query results along with the bookmark of the next page.
+// Records holds a []queryResult, or a []historyResult for history queries
+type paginatedQueryResult struct {
+	Records             interface{} `json:"records"`
+	FetchedRecordsCount int32       `json:"fetchedRecordsCount"`
+	Bookmark            string      `json:"bookmark"`
+}
+
 // ===================================================================================
 // Main
 // ===================================================================================
@@ -113,10 +171,37 @@ func main() {
 	}
 }
 
-// Init initializes chaincode
-// ===========================
+// Init initializes chaincode, optionally setting the marble validation config.
+// Init also runs on upgrade, so it adds marbles created by earlier versions to the
+// owner~name index
+// ===========================================================================
 func (t *SimpleChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
-	return shim.Success(nil)
+	_, args := stub.GetFunctionAndParameters()
+
+	//   0
+	// "config"
+	if len(args) > 1 {
+		return failure(codeInvalidArgument, "Incorrect number of arguments. Expecting 0 or 1")
+	}
+
+	err := reindexOwners(stub)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	if len(args) == 0 || args[0] == "" {
+		return success(nil)
+	}
+
+	config, err := parseConfig(args[0])
+	if err != nil {
+		return errorResponse(err)
+	}
+	err = putConfig(stub, config)
+	if err != nil {
+		return errorResponse(err)
+	}
+	return success(config)
 }
 
 // Invoke - Our entry point for Invocations
@@ -138,20 +223,36 @@ func (t *SimpleChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
 		return t.readMarble(stub, args)
 	} else if function == "queryMarblesByOwner" { //find marbles for owner X using rich query
 		return t.queryMarblesByOwner(stub, args)
-	} else if function == "queryMarbles" { //find marbles based on an ad hoc rich query
+	} else if function == "queryMarbles" { //find marbles based on an ad hoc structured rich query
 		return t.queryMarbles(stub, args)
 	} else if function == "getHistoryForMarble" { //get history of values for a marble
 		return t.getHistoryForMarble(stub, args)
 	} else if function == "getMarblesByRange" { //get marbles based on range query
 		return t.getMarblesByRange(stub, args)
+	} else if function == "getMarblesByOwnerIndex" { //find marbles for owner X using the owner~name index
+		return t.getMarblesByOwnerIndex(stub, args)
 	} else if function == "getMarblesByRangeWithPagination" {
 		return t.getMarblesByRangeWithPagination(stub, args)
 	} else if function == "queryMarblesWithPagination" {
 		return t.queryMarblesWithPagination(stub, args)
+	} else if function == "getMarblesByColorWithPagination" {
+		return t.getMarblesByColorWithPagination(stub, args)
+	} else if function == "getHistoryForMarbleWithPagination" {
+		return t.getHistoryForMarbleWithPagination(stub, args)
+	} else if function == "openAuction" { //put a marble up for auction
+		return t.openAuction(stub, args)
+	} else if function == "bid" { //bid on a marble in an open auction
+		return t.bid(stub, args)
+	} else if function == "closeAuction" { //close an auction and hand the marble to the winner
+		return t.closeAuction(stub, args)
+	} else if function == "getAuction" { //read an auction and its bids
+		return t.getAuction(stub, args)
+	} else if function == "getConfig" { //read the marble validation config
+		return t.getConfig(stub, args)
 	}
 
 	fmt.Println("invoke did not find func: " + function) //error
-	return shim.Error("Received unknown function invocation")
+	return failure(codeUnknownFunction, "Received unknown function invocation")
 }
 
 // ============================================================
@@ -163,38 +264,48 @@ func (t *SimpleChaincode) initMarble(stub shim.ChaincodeStubInterface, args []st
 	//   0       1       2     3
 	// "asdf", "blue", "35", "bob"
 	if len(args) != 4 {
-		return shim.Error("Incorrect number of arguments. Expecting 4")
+		return failure(codeInvalidArgument, "Incorrect number of arguments. Expecting 4")
 	}
 
 	// ==== Input sanitation ====
 	fmt.Println("- start init marble")
 	if len(args[0]) <= 0 {
-		return shim.Error("1st argument must be a non-empty string")
+		return failure(codeInvalidArgument, "1st argument must be a non-empty string")
 	}
 	if len(args[1]) <= 0 {
-		return shim.Error("2nd argument must be a non-empty string")
+		return failure(codeInvalidArgument, "2nd argument must be a non-empty string")
 	}
 	if len(args[2]) <= 0 {
-		return shim.Error("3rd argument must be a non-empty string")
+		return failure(codeInvalidArgument, "3rd argument must be a non-empty string")
 	}
 	if len(args[3]) <= 0 {
-		return shim.Error("4th argument must be a non-empty string")
+		return failure(codeInvalidArgument, "4th argument must be a non-empty string")
 	}
 	marbleName := args[0]
 	color := strings.ToLower(args[1])
 	owner := strings.ToLower(args[3])
 	size, err := strconv.Atoi(args[2])
 	if err != nil {
-		return shim.Error("3rd argument must be a numeric string")
+		return failure(codeInvalidArgument, "3rd argument must be a numeric string")
+	}
+
+	// ==== Check the marble against the validation config ====
+	config, err := getConfigState(stub)
+	if err != nil {
+		return errorResponse(err)
+	}
+	err = config.validate(marbleName, color, size)
+	if err != nil {
+		return errorResponse(err)
 	}
 
 	// ==== Check if marble already exists ====
 	marbleAsBytes, err := stub.GetState(marbleName)
 	if err != nil {
-		return shim.Error("Failed to get marble: " + err.Error())
+		return failure(codeInternal, "Failed to get marble: %s", err.Error())
 	} else if marbleAsBytes != nil {
 		fmt.Println("This marble already exists: " + marbleName)
-		return shim.Error("This marble already exists: " + marbleName)
+		return failure(codeMarbleExists, "This marble already exists: %s", marbleName)
 	}
 
 	// ==== Create marble object and marshal to JSON ====
@@ -202,7 +313,7 @@ func (t *SimpleChaincode) initMarble(stub shim.ChaincodeStubInterface, args []st
 	marble := &marble{objectType, marbleName, color, size, owner}
 	marbleJSONasBytes, err := json.Marshal(marble)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 	//Alternatively, build the marble json string manually if you don't want to use struct marshalling
 	//marbleJSONasString := `{"docType":"Marble",  "name": "` + marbleName + `", "color": "` + color + `", "size": ` + strconv.Itoa(size) + `, "owner": "` + owner + `"}`
@@ -211,7 +322,7 @@ func (t *SimpleChaincode) initMarble(stub shim.ChaincodeStubInterface, args []st
 	// === Save marble to state ===
 	err = stub.PutState(marbleName, marbleJSONasBytes)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
 	//  ==== Index the marble to enable color-based range queries, e.g. return all blue marbles ====
@@ -222,87 +333,109 @@ func (t *SimpleChaincode) initMarble(stub shim.ChaincodeStubInterface, args []st
 	indexName := "color~name"
 	colorNameIndexKey, err := stub.CreateCompositeKey(indexName, []string{marble.Color, marble.Name})
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 	//  Save index entry to state. Only the key name is needed, no need to store a duplicate copy of the marble.
 	//  Note - passing a 'nil' value will effectively delete the key from state, therefore we pass null character as value
 	value := []byte{0x00}
-	stub.PutState(colorNameIndexKey, value)
+	err = stub.PutState(colorNameIndexKey, value)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	//  ==== Index the marble by owner as well, so marbles of an owner can be found on any state database ====
+	ownerNameIndexKey, err := stub.CreateCompositeKey("owner~name", []string{marble.Owner, marble.Name})
+	if err != nil {
+		return errorResponse(err)
+	}
+	err = stub.PutState(ownerNameIndexKey, value)
+	if err != nil {
+		return errorResponse(err)
+	}
 
 	// ==== Marble saved and indexed. Return success ====
 	fmt.Println("- end init marble")
-	return shim.Success(nil)
+	return success(nil)
 }
 
 // ===============================================
 // readMarble - read a marble from chaincode state
 // ===============================================
 func (t *SimpleChaincode) readMarble(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	var name, jsonResp string
+	var name string
 	var err error
 
 	if len(args) != 1 {
-		return shim.Error("Incorrect number of arguments. Expecting name of the marble to query")
+		return failure(codeInvalidArgument, "Incorrect number of arguments. Expecting name of the marble to query")
 	}
 
 	name = args[0]
 	valAsbytes, err := stub.GetState(name) //get the marble from chaincode state
 	if err != nil {
-		jsonResp = "{\"Error\":\"Failed to get state for " + name + "\"}"
-		return shim.Error(jsonResp)
+		return failure(codeInternal, "Failed to get state for %s", name)
 	} else if valAsbytes == nil {
-		jsonResp = "{\"Error\":\"Marble does not exist: " + name + "\"}"
-		return shim.Error(jsonResp)
+		return failure(codeMarbleNotFound, "Marble does not exist: %s", name)
 	}
 
-	return shim.Success(valAsbytes)
+	return success(json.RawMessage(valAsbytes))
 }
 
 // ==================================================
 // delete - remove a marble key/value pair from state
 // ==================================================
 func (t *SimpleChaincode) delete(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	var jsonResp string
 	var marbleJSON marble
 	if len(args) != 1 {
-		return shim.Error("Incorrect number of arguments. Expecting 1")
+		return failure(codeInvalidArgument, "Incorrect number of arguments. Expecting 1")
 	}
 	marbleName := args[0]
 
-	// to maintain the color~name index, we need to read the marble first and get its color
+	// to maintain the color~name and owner~name indexes, we need to read the marble first and get its color and owner
 	valAsbytes, err := stub.GetState(marbleName) //get the marble from chaincode state
 	if err != nil {
-		jsonResp = "{\"Error\":\"Failed to get state for " + marbleName + "\"}"
-		return shim.Error(jsonResp)
+		return failure(codeInternal, "Failed to get state for %s", marbleName)
 	} else if valAsbytes == nil {
-		jsonResp = "{\"Error\":\"Marble does not exist: " + marbleName + "\"}"
-		return shim.Error(jsonResp)
+		return failure(codeMarbleNotFound, "Marble does not exist: %s", marbleName)
 	}
 
 	err = json.Unmarshal([]byte(valAsbytes), &marbleJSON)
 	if err != nil {
-		jsonResp = "{\"Error\":\"Failed to decode JSON of: " + marbleName + "\"}"
-		return shim.Error(jsonResp)
+		return failure(codeInternal, "Failed to decode JSON of: %s", marbleName)
+	}
+
+	// a marble under auction may not be deleted
+	err = checkNotAuctioned(stub, marbleName)
+	if err != nil {
+		return errorResponse(err)
 	}
 
 	err = stub.DelState(marbleName) //remove the marble from chaincode state
 	if err != nil {
-		return shim.Error("Failed to delete state:" + err.Error())
+		return failure(codeInternal, "Failed to delete state: %s", err.Error())
 	}
 
-	// maintain the index
+	// maintain the indexes
 	indexName := "color~name"
 	colorNameIndexKey, err := stub.CreateCompositeKey(indexName, []string{marbleJSON.Color, marbleJSON.Name})
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
 	//  Delete index entry to state.
 	err = stub.DelState(colorNameIndexKey)
 	if err != nil {
-		return shim.Error("Failed to delete state:" + err.Error())
+		return failure(codeInternal, "Failed to delete state: %s", err.Error())
+	}
+
+	ownerNameIndexKey, err := stub.CreateCompositeKey("owner~name", []string{marbleJSON.Owner, marbleJSON.Name})
+	if err != nil {
+		return errorResponse(err)
 	}
-	return shim.Success(nil)
+	err = stub.DelState(ownerNameIndexKey)
+	if err != nil {
+		return failure(codeInternal, "Failed to delete state: %s", err.Error())
+	}
+	return success(nil)
 }
 
 // ===========================================================
@@ -313,88 +446,141 @@ func (t *SimpleChaincode) transferMarble(stub shim.ChaincodeStubInterface, args
 	//   0       1
 	// "name", "bob"
 	if len(args) < 2 {
-		return shim.Error("Incorrect number of arguments. Expecting 2")
+		return failure(codeInvalidArgument, "Incorrect number of arguments. Expecting 2")
 	}
 
 	marbleName := args[0]
 	newOwner := strings.ToLower(args[1])
 	fmt.Println("- start transferMarble ", marbleName, newOwner)
 
+	// a marble under auction can only change hands when the auction closes
+	err := checkNotAuctioned(stub, marbleName)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	err = setMarbleOwner(stub, marbleName, newOwner)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	fmt.Println("- end transferMarble (success)")
+	return success(nil)
+}
+
+// ===========================================================
+// reindexOwners adds an owner~name index entry for every marble in state. Marbles created
+// before the index was introduced have no entry, and rewriting an existing entry is harmless.
+// A range query over the whole namespace only returns simple keys, so index entries and
+// other composite keys are not visited; records that are not marbles are skipped
+// ===========================================================
+func reindexOwners(stub shim.ChaincodeStubInterface) error {
+	resultsIterator, err := stub.GetStateByRange("", "")
+	if err != nil {
+		return err
+	}
+	defer resultsIterator.Close()
+
+	count := 0
+	for resultsIterator.HasNext() {
+		responseRange, err := resultsIterator.Next()
+		if err != nil {
+			return err
+		}
+
+		marbleJSON := marble{}
+		err = json.Unmarshal(responseRange.Value, &marbleJSON)
+		if err != nil || marbleJSON.ObjectType != "marble" {
+			continue
+		}
+
+		ownerNameIndexKey, err := stub.CreateCompositeKey("owner~name", []string{marbleJSON.Owner, marbleJSON.Name})
+		if err != nil {
+			return err
+		}
+		err = stub.PutState(ownerNameIndexKey, []byte{0x00})
+		if err != nil {
+			return err
+		}
+		count++
+	}
+
+	fmt.Printf("- reindexOwners indexed %d marbles\n", count)
+	return nil
+}
+
+// ===========================================================
+// setMarbleOwner rewrites a marble with a new owner and updates the owner~name index
+// ===========================================================
+func setMarbleOwner(stub shim.ChaincodeStubInterface, marbleName string, newOwner string) error {
 	marbleAsBytes, err := stub.GetState(marbleName)
 	if err != nil {
-		return shim.Error("Failed to get marble:" + err.Error())
+		return fmt.Errorf("Failed to get marble: %s", err.Error())
 	} else if marbleAsBytes == nil {
-		return shim.Error("Marble does not exist")
+		return newError(codeMarbleNotFound, "Marble does not exist: %s", marbleName)
 	}
 
 	marbleToTransfer := marble{}
 	err = json.Unmarshal(marbleAsBytes, &marbleToTransfer) //unmarshal it aka JSON.parse()
 	if err != nil {
-		return shim.Error(err.Error())
+		return err
 	}
-	marbleToTransfer.Owner = newOwner //change the owner
 
-	marbleJSONasBytes, _ := json.Marshal(marbleToTransfer)
-	err = stub.PutState(marbleName, marbleJSONasBytes) //rewrite the marble
+	// move the marble to the new owner in the owner~name index
+	oldOwnerNameIndexKey, err := stub.CreateCompositeKey("owner~name", []string{marbleToTransfer.Owner, marbleToTransfer.Name})
 	if err != nil {
-		return shim.Error(err.Error())
+		return err
+	}
+	err = stub.DelState(oldOwnerNameIndexKey)
+	if err != nil {
+		return err
+	}
+	newOwnerNameIndexKey, err := stub.CreateCompositeKey("owner~name", []string{newOwner, marbleToTransfer.Name})
+	if err != nil {
+		return err
+	}
+	err = stub.PutState(newOwnerNameIndexKey, []byte{0x00})
+	if err != nil {
+		return err
 	}
 
-	fmt.Println("- end transferMarble (success)")
-	return shim.Success(nil)
+	marbleToTransfer.Owner = newOwner //change the owner
+
+	marbleJSONasBytes, _ := json.Marshal(marbleToTransfer)
+	return stub.PutState(marbleName, marbleJSONasBytes) //rewrite the marble
 }
 
 // ===========================================================================================
-// constructQueryResponseFromIterator constructs a JSON array containing query results from
-// a given result iterator
+// constructQueryResponseFromIterator reads the query results from a given result iterator
 // ===========================================================================================
-func constructQueryResponseFromIterator(resultsIterator shim.StateQueryIteratorInterface) (*bytes.Buffer, error) {
-	// buffer is a JSON array containing QueryResults
-	var buffer bytes.Buffer
-	buffer.WriteString("[")
-
-	bArrayMemberAlreadyWritten := false
+func constructQueryResponseFromIterator(resultsIterator shim.StateQueryIteratorInterface) ([]queryResult, error) {
+	records := []queryResult{}
 	for resultsIterator.HasNext() {
 		queryResponse, err := resultsIterator.Next()
 		if err != nil {
 			return nil, err
 		}
-		// Add a comma before array members, suppress it for the first array member
-		if bArrayMemberAlreadyWritten == true {
-			buffer.WriteString(",")
-		}
-		buffer.WriteString("{\"Key\":")
-		buffer.WriteString("\"")
-		buffer.WriteString(queryResponse.Key)
-		buffer.WriteString("\"")
-
-		buffer.WriteString(", \"Record\":")
-		// Record is a JSON object, so we write as-is
-		buffer.WriteString(string(queryResponse.Value))
-		buffer.WriteString("}")
-		bArrayMemberAlreadyWritten = true
+		records = append(records, queryResult{Key: queryResponse.Key, Record: queryResponse.Value})
 	}
-	buffer.WriteString("]")
-
-	return &buffer, nil
+	return records, nil
 }
 
 // ===========================================================================================
-// addPaginationMetadataToQueryResults adds QueryResponseMetadata, which contains pagination
-// info, to the constructed query results
+// constructPaginatedQueryResponse constructs a JSON object containing a page of query results
+// from a given result iterator, along with the number of records fetched and the bookmark to
+// pass in to fetch the next page
 // ===========================================================================================
-func addPaginationMetadataToQueryResults(buffer *bytes.Buffer, responseMetadata *pb.QueryResponseMetadata) *bytes.Buffer {
-
-	buffer.WriteString("[{\"ResponseMetadata\":{\"RecordsCount\":")
-	buffer.WriteString("\"")
-	buffer.WriteString(fmt.Sprintf("%v", responseMetadata.FetchedRecordsCount))
-	buffer.WriteString("\"")
-	buffer.WriteString(", \"Bookmark\":")
-	buffer.WriteString("\"")
-	buffer.WriteString(responseMetadata.Bookmark)
-	buffer.WriteString("\"}}]")
-
-	return buffer
+func constructPaginatedQueryResponse(resultsIterator shim.StateQueryIteratorInterface, responseMetadata *pb.QueryResponseMetadata) ([]byte, error) {
+	records, err := constructQueryResponseFromIterator(resultsIterator)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(paginatedQueryResult{
+		Records:             records,
+		FetchedRecordsCount: responseMetadata.FetchedRecordsCount,
+		Bookmark:            responseMetadata.Bookmark,
+	})
 }
 
 // ===========================================================================================
@@ -411,7 +597,7 @@ func addPaginationMetadataToQueryResults(buffer *bytes.Buffer, responseMetadata
 func (t *SimpleChaincode) getMarblesByRange(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 
 	if len(args) < 2 {
-		return shim.Error("Incorrect number of arguments. Expecting 2")
+		return failure(codeInvalidArgument, "Incorrect number of arguments. Expecting 2")
 	}
 
 	startKey := args[0]
@@ -419,22 +605,26 @@ func (t *SimpleChaincode) getMarblesByRange(stub shim.ChaincodeStubInterface, ar
 
 	resultsIterator, err := stub.GetStateByRange(startKey, endKey)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 	defer resultsIterator.Close()
 
-	buffer, err := constructQueryResponseFromIterator(resultsIterator)
+	records, err := constructQueryResponseFromIterator(resultsIterator)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
-	fmt.Printf("- getMarblesByRange queryResult:\n%s\n", buffer.String())
+	fmt.Printf("- getMarblesByRange found %d marbles\n", len(records))
 
-	return shim.Success(buffer.Bytes())
+	return success(records)
 }
 
 // ==== Example: GetStateByPartialCompositeKey/RangeQuery =========================================
 // transferMarblesBasedOnColor will transfer marbles of a given color to a certain new owner.
+// Optional arguments cap the number of marbles transferred (0 for no limit), request a dry run
+// that only lists the marbles that would be transferred, and select only the marbles of one
+// owner. Marbles locked by an open auction are skipped. Returns a JSON summary of the names
+// of the marbles transferred and of the marbles skipped.
 // Uses a GetStateByPartialCompositeKey (range query) against color~name 'index'.
 // Committing peers will re-execute range queries to guarantee that result sets are stable
 // between endorsement time and commit time. The transaction is invalidated by the
@@ -443,54 +633,229 @@ func (t *SimpleChaincode) getMarblesByRange(stub shim.ChaincodeStubInterface, ar
 // ===========================================================================================
 func (t *SimpleChaincode) transferMarblesBasedOnColor(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 
-	//   0       1
-	// "color", "bob"
-	if len(args) < 2 {
-		return shim.Error("Incorrect number of arguments. Expecting 2")
+	//   0       1      2       3        4
+	// "color", "bob", "10", "false", "tom"
+	if len(args) < 2 || len(args) > 5 {
+		return failure(codeInvalidArgument, "Incorrect number of arguments. Expecting 2 to 5")
 	}
 
-	color := args[0]
+	color := strings.ToLower(args[0])
 	newOwner := strings.ToLower(args[1])
-	fmt.Println("- start transferMarblesBasedOnColor ", color, newOwner)
+	maxCount := 0
+	dryRun := false
+	ownerFilter := ""
+	var err error
+	if len(args) > 2 && args[2] != "" {
+		maxCount, err = strconv.Atoi(args[2])
+		if err != nil {
+			return failure(codeInvalidArgument, "3rd argument must be a numeric string")
+		}
+		if maxCount < 0 {
+			return failure(codeInvalidArgument, "3rd argument must not be negative")
+		}
+	}
+	if len(args) > 3 && args[3] != "" {
+		dryRun, err = strconv.ParseBool(args[3])
+		if err != nil {
+			return failure(codeInvalidArgument, "4th argument must be true or false")
+		}
+	}
+	if len(args) > 4 {
+		ownerFilter = strings.ToLower(args[4])
+	}
+	fmt.Println("- start transferMarblesBasedOnColor ", color, newOwner, maxCount, dryRun, ownerFilter)
 
 	// Query the color~name index by color
 	// This will execute a key range query on all keys starting with 'color'
 	coloredMarbleResultsIterator, err := stub.GetStateByPartialCompositeKey("color~name", []string{color})
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 	defer coloredMarbleResultsIterator.Close()
 
-	// Iterate through result set and for each marble found, transfer to newOwner
-	var i int
-	for i = 0; coloredMarbleResultsIterator.HasNext(); i++ {
+	summary := transferSummary{
+		Color:    color,
+		NewOwner: newOwner,
+		DryRun:   dryRun,
+		Marbles:  []string{},
+		Locked:   []string{},
+	}
+
+	// Iterate through result set and for each marble found, transfer to newOwner.
+	// If any transfer fails the whole transaction fails, so either every selected
+	// marble that is not locked changes hands or none does.
+	for coloredMarbleResultsIterator.HasNext() {
 		// Note that we don't get the value (2nd return variable), we'll just get the marble name from the composite key
 		responseRange, err := coloredMarbleResultsIterator.Next()
 		if err != nil {
-			return shim.Error(err.Error())
+			return errorResponse(err)
 		}
 
 		// get the color and name from color~name composite key
 		objectType, compositeKeyParts, err := stub.SplitCompositeKey(responseRange.Key)
 		if err != nil {
-			return shim.Error(err.Error())
+			return errorResponse(err)
 		}
 		returnedColor := compositeKeyParts[0]
 		returnedMarbleName := compositeKeyParts[1]
 		fmt.Printf("- found a marble from index:%s color:%s name:%s\n", objectType, returnedColor, returnedMarbleName)
 
-		// Now call the transfer function for the found marble.
-		// Re-use the same function that is used to transfer individual marbles
-		response := t.transferMarble(stub, []string{returnedMarbleName, newOwner})
-		// if the transfer failed break out of loop and return error
-		if response.Status != shim.OK {
-			return shim.Error("Transfer failed: " + response.Message)
+		if ownerFilter != "" {
+			marbleAsBytes, err := stub.GetState(returnedMarbleName)
+			if err != nil {
+				return failure(codeInternal, "Failed to get marble: %s", err.Error())
+			} else if marbleAsBytes == nil {
+				return failure(codeInternal, "Index entry found for missing marble: %s", returnedMarbleName)
+			}
+			marbleJSON := marble{}
+			err = json.Unmarshal(marbleAsBytes, &marbleJSON)
+			if err != nil {
+				return errorResponse(err)
+			}
+			if marbleJSON.Owner != ownerFilter {
+				continue
+			}
+		}
+
+		// a marble under auction can only change hands when the auction closes.
+		// This is checked on a dry run as well, so it reports what a real run would do
+		err = checkNotAuctioned(stub, returnedMarbleName)
+		if e, ok := err.(*marbleError); ok && e.Code == codeMarbleLocked {
+			summary.Locked = append(summary.Locked, returnedMarbleName)
+			continue
+		} else if err != nil {
+			return errorResponse(err)
+		}
+
+		// only a marble that could have been transferred counts towards HasMore
+		if maxCount > 0 && len(summary.Marbles) == maxCount {
+			summary.HasMore = true
+			break
+		}
+
+		if !dryRun {
+			err = setMarbleOwner(stub, returnedMarbleName, newOwner)
+			if err != nil {
+				return errorResponse(err)
+			}
+		}
+		summary.Marbles = append(summary.Marbles, returnedMarbleName)
+	}
+
+	fmt.Printf("- end transferMarblesBasedOnColor: %+v\n", summary)
+	return success(summary)
+}
+
+// ==== Example: GetStateByPartialCompositeKeyWithPagination ================================
+// getMarblesByOwnerIndex returns a page of the marbles of a given owner, found through the
+// owner~name index. Unlike queryMarblesByOwner it does not need a rich query, so it works
+// on any state database. Marbles created before the index was introduced are added to it
+// when the chaincode is upgraded, see Init.
+// Paginated queries are only valid for read only transactions.
+// ===========================================================================================
+func (t *SimpleChaincode) getMarblesByOwnerIndex(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+
+	//   0      1    2
+	// "bob", "3", ""
+	if len(args) < 3 {
+		return failure(codeInvalidArgument, "Incorrect number of arguments. Expecting 3")
+	}
+
+	owner := strings.ToLower(args[0])
+	//return type of ParseInt is int64
+	pageSize, err := strconv.ParseInt(args[1], 10, 32)
+	if err != nil {
+		return failure(codeInvalidArgument, "2nd argument must be a numeric string")
+	}
+	if pageSize <= 0 {
+		return failure(codeInvalidArgument, "Page size must be greater than zero")
+	}
+	bookmark := args[2]
+
+	queryResults, err := getMarblesByIndexWithPagination(stub, "owner~name", owner, int32(pageSize), bookmark)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	fmt.Printf("- getMarblesByOwnerIndex queryResult:\n%s\n", queryResults)
+
+	return success(json.RawMessage(queryResults))
+}
+
+// ===========================================================================================
+// getMarblesByColorWithPagination returns a page of the marbles of a given color, found
+// through the color~name index.
+// Paginated queries are only valid for read only transactions.
+// ===========================================================================================
+func (t *SimpleChaincode) getMarblesByColorWithPagination(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+
+	//   0       1    2
+	// "blue", "3", ""
+	if len(args) < 3 {
+		return failure(codeInvalidArgument, "Incorrect number of arguments. Expecting 3")
+	}
+
+	color := strings.ToLower(args[0])
+	//return type of ParseInt is int64
+	pageSize, err := strconv.ParseInt(args[1], 10, 32)
+	if err != nil {
+		return failure(codeInvalidArgument, "2nd argument must be a numeric string")
+	}
+	if pageSize <= 0 {
+		return failure(codeInvalidArgument, "Page size must be greater than zero")
+	}
+	bookmark := args[2]
+
+	queryResults, err := getMarblesByIndexWithPagination(stub, "color~name", color, int32(pageSize), bookmark)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	fmt.Printf("- getMarblesByColorWithPagination queryResult:\n%s\n", queryResults)
+
+	return success(json.RawMessage(queryResults))
+}
+
+// ===========================================================================================
+// getMarblesByIndexWithPagination reads a page of an attribute~name index for the given
+// attribute value, and returns the marbles the index entries point to along with the
+// bookmark of the next page
+// ===========================================================================================
+func getMarblesByIndexWithPagination(stub shim.ChaincodeStubInterface, indexName string, attribute string, pageSize int32, bookmark string) ([]byte, error) {
+	resultsIterator, responseMetadata, err := stub.GetStateByPartialCompositeKeyWithPagination(indexName, []string{attribute}, pageSize, bookmark)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	records := []queryResult{}
+	for resultsIterator.HasNext() {
+		responseRange, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
 		}
+
+		// get the marble name from the composite key, then the marble itself
+		_, compositeKeyParts, err := stub.SplitCompositeKey(responseRange.Key)
+		if err != nil {
+			return nil, err
+		}
+		marbleName := compositeKeyParts[1]
+
+		marbleAsBytes, err := stub.GetState(marbleName)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to get marble: %s", err.Error())
+		} else if marbleAsBytes == nil {
+			return nil, fmt.Errorf("Index entry found for missing marble: %s", marbleName)
+		}
+		records = append(records, queryResult{Key: marbleName, Record: marbleAsBytes})
 	}
 
-	responsePayload := fmt.Sprintf("Transferred %d %s marbles to %s", i, color, newOwner)
-	fmt.Println("- end transferMarblesBasedOnColor: " + responsePayload)
-	return shim.Success([]byte(responsePayload))
+	return json.Marshal(paginatedQueryResult{
+		Records:             records,
+		FetchedRecordsCount: responseMetadata.FetchedRecordsCount,
+		Bookmark:            responseMetadata.Bookmark,
+	})
 }
 
 // =======Rich queries =========================================================================
@@ -517,42 +882,53 @@ func (t *SimpleChaincode) queryMarblesByOwner(stub shim.ChaincodeStubInterface,
 	//   0
 	// "bob"
 	if len(args) < 1 {
-		return shim.Error("Incorrect number of arguments. Expecting 1")
+		return failure(codeInvalidArgument, "Incorrect number of arguments. Expecting 1")
 	}
 
 	owner := strings.ToLower(args[0])
 
-	queryString := fmt.Sprintf("{\"selector\":{\"docType\":\"marble\",\"owner\":\"%s\"}}", owner)
+	queryString, err := buildQueryString(marbleQuery{
+		Conditions: []queryCondition{{Field: "owner", Operator: "$eq", Value: owner}},
+	}, false)
+	if err != nil {
+		return errorResponse(err)
+	}
 
 	queryResults, err := getQueryResultForQueryString(stub, queryString)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	return shim.Success(queryResults)
+	return success(json.RawMessage(queryResults))
 }
 
 // ===== Example: Ad hoc rich query ========================================================
-// queryMarbles uses a query string to perform a query for marbles.
-// Query string matching state database syntax is passed in and executed as is.
-// Supports ad hoc queries that can be defined at runtime by the client.
-// If this is not desired, follow the queryMarblesForOwner example for parameterized queries.
+// queryMarbles uses a structured query to perform a query for marbles.
+// Supports ad hoc queries that can be defined at runtime by the client, limited to the
+// fields, operators and indexes allowed by buildQueryString.
 // Only available on state databases that support rich query (e.g. CouchDB)
 // =========================================================================================
 func (t *SimpleChaincode) queryMarbles(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 
 	//   0
-	// "queryString"
+	// "query"
 	if len(args) < 1 {
-		return shim.Error("Incorrect number of arguments. Expecting 1")
+		return failure(codeInvalidArgument, "Incorrect number of arguments. Expecting 1")
 	}
 
-	queryString := args[0]
+	query, err := parseMarbleQuery(args[0])
+	if err != nil {
+		return errorResponse(err)
+	}
+	queryString, err := buildQueryString(query, false)
+	if err != nil {
+		return errorResponse(err)
+	}
 
 	queryResults, err := getQueryResultForQueryString(stub, queryString)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	return shim.Success(queryResults)
+	return success(json.RawMessage(queryResults))
 }
 
 // =========================================================================================
@@ -569,14 +945,19 @@ func getQueryResultForQueryString(stub shim.ChaincodeStubInterface, queryString
 	}
 	defer resultsIterator.Close()
 
-	buffer, err := constructQueryResponseFromIterator(resultsIterator)
+	records, err := constructQueryResponseFromIterator(resultsIterator)
+	if err != nil {
+		return nil, err
+	}
+
+	queryResults, err := json.Marshal(records)
 	if err != nil {
 		return nil, err
 	}
 
-	fmt.Printf("- getQueryResultForQueryString queryResult:\n%s\n", buffer.String())
+	fmt.Printf("- getQueryResultForQueryString queryResult:\n%s\n", queryResults)
 
-	return buffer.Bytes(), nil
+	return queryResults, nil
 }
 
 // ====== Pagination =========================================================================
@@ -601,7 +982,7 @@ func getQueryResultForQueryString(stub shim.ChaincodeStubInterface, queryString
 func (t *SimpleChaincode) getMarblesByRangeWithPagination(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 
 	if len(args) < 4 {
-		return shim.Error("Incorrect number of arguments. Expecting 4")
+		return failure(codeInvalidArgument, "Incorrect number of arguments. Expecting 4")
 	}
 
 	startKey := args[0]
@@ -609,63 +990,75 @@ func (t *SimpleChaincode) getMarblesByRangeWithPagination(stub shim.ChaincodeStu
 	//return type of ParseInt is int64
 	pageSize, err := strconv.ParseInt(args[2], 10, 32)
 	if err != nil {
-		return shim.Error(err.Error())
+		return failure(codeInvalidArgument, "3rd argument must be a numeric string")
+	}
+	if pageSize <= 0 {
+		return failure(codeInvalidArgument, "Page size must be greater than zero")
 	}
 	bookmark := args[3]
 
 	resultsIterator, responseMetadata, err := stub.GetStateByRangeWithPagination(startKey, endKey, int32(pageSize), bookmark)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 	defer resultsIterator.Close()
 
-	buffer, err := constructQueryResponseFromIterator(resultsIterator)
+	queryResults, err := constructPaginatedQueryResponse(resultsIterator, responseMetadata)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
-	bufferWithPaginationInfo := addPaginationMetadataToQueryResults(buffer, responseMetadata)
+	fmt.Printf("- getMarblesByRangeWithPagination queryResult:\n%s\n", queryResults)
 
-	fmt.Printf("- getMarblesByRange queryResult:\n%s\n", bufferWithPaginationInfo.String())
-
-	return shim.Success(buffer.Bytes())
+	return success(json.RawMessage(queryResults))
 }
 
 // ===== Example: Pagination with Ad hoc Rich Query ========================================================
-// queryMarblesWithPagination uses a query string, page size and a bookmark to perform a query
-// for marbles. Query string matching state database syntax is passed in and executed as is.
+// queryMarblesWithPagination uses a structured query, page size and a bookmark to perform a
+// query for marbles. The query may not have a limit of its own.
 // The number of fetched records would be equal to or lesser than the specified page size.
-// Supports ad hoc queries that can be defined at runtime by the client.
-// If this is not desired, follow the queryMarblesForOwner example for parameterized queries.
+// Supports ad hoc queries that can be defined at runtime by the client, limited to the
+// fields, operators and indexes allowed by buildQueryString.
 // Only available on state databases that support rich query (e.g. CouchDB)
 // Paginated queries are only valid for read only transactions.
 // =========================================================================================
 func (t *SimpleChaincode) queryMarblesWithPagination(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 
-	//   0
-	// "queryString"
+	//   0        1    2
+	// "query", "3", ""
 	if len(args) < 3 {
-		return shim.Error("Incorrect number of arguments. Expecting 3")
+		return failure(codeInvalidArgument, "Incorrect number of arguments. Expecting 3")
 	}
 
-	queryString := args[0]
+	query, err := parseMarbleQuery(args[0])
+	if err != nil {
+		return errorResponse(err)
+	}
+	queryString, err := buildQueryString(query, true)
+	if err != nil {
+		return errorResponse(err)
+	}
 	//return type of ParseInt is int64
 	pageSize, err := strconv.ParseInt(args[1], 10, 32)
 	if err != nil {
-		return shim.Error(err.Error())
+		return failure(codeInvalidArgument, "2nd argument must be a numeric string")
+	}
+	if pageSize <= 0 {
+		return failure(codeInvalidArgument, "Page size must be greater than zero")
 	}
 	bookmark := args[2]
 
 	queryResults, err := getQueryResultForQueryStringWithPagination(stub, queryString, int32(pageSize), bookmark)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	return shim.Success(queryResults)
+	return success(json.RawMessage(queryResults))
 }
 
 // =========================================================================================
 // getQueryResultForQueryStringWithPagination executes the passed in query string with
-// pagination info. Result set is built and returned as a byte array containing the JSON results.
+// pagination info. Result set is built and returned as a byte array containing the JSON results
+// and the bookmark of the next page.
 // =========================================================================================
 func getQueryResultForQueryStringWithPagination(stub shim.ChaincodeStubInterface, queryString string, pageSize int32, bookmark string) ([]byte, error) {
 
@@ -677,79 +1070,141 @@ func getQueryResultForQueryStringWithPagination(stub shim.ChaincodeStubInterface
 	}
 	defer resultsIterator.Close()
 
-	buffer, err := constructQueryResponseFromIterator(resultsIterator)
+	queryResults, err := constructPaginatedQueryResponse(resultsIterator, responseMetadata)
 	if err != nil {
 		return nil, err
 	}
 
-	bufferWithPaginationInfo := addPaginationMetadataToQueryResults(buffer, responseMetadata)
-
-	fmt.Printf("- getQueryResultForQueryString queryResult:\n%s\n", bufferWithPaginationInfo.String())
+	fmt.Printf("- getQueryResultForQueryString queryResult:\n%s\n", queryResults)
 
-	return buffer.Bytes(), nil
+	return queryResults, nil
 }
 
+// ===========================================================================================
+// getHistoryForMarble returns every change made to a marble
+// ===========================================================================================
 func (t *SimpleChaincode) getHistoryForMarble(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 
 	if len(args) < 1 {
-		return shim.Error("Incorrect number of arguments. Expecting 1")
+		return failure(codeInvalidArgument, "Incorrect number of arguments. Expecting 1")
 	}
 
 	marbleName := args[0]
 
 	fmt.Printf("- start getHistoryForMarble: %s\n", marbleName)
 
+	history, err := getHistory(stub, marbleName)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	// historyAsBytes is a JSON array containing historic values for the marble
+	historyAsBytes, err := json.Marshal(history)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	fmt.Printf("- getHistoryForMarble returning:\n%s\n", historyAsBytes)
+
+	return success(json.RawMessage(historyAsBytes))
+}
+
+// ===========================================================================================
+// getHistoryForMarbleWithPagination returns a page of the changes made to a marble. The
+// history of a key cannot be paged by the peer, so the bookmark is the transaction id of the
+// last change returned and the next page starts after it.
+// ===========================================================================================
+func (t *SimpleChaincode) getHistoryForMarbleWithPagination(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+
+	//   0          1    2
+	// "marble1", "3", ""
+	if len(args) < 3 {
+		return failure(codeInvalidArgument, "Incorrect number of arguments. Expecting 3")
+	}
+
+	marbleName := args[0]
+	//return type of ParseInt is int64
+	pageSize, err := strconv.ParseInt(args[1], 10, 32)
+	if err != nil {
+		return failure(codeInvalidArgument, "2nd argument must be a numeric string")
+	}
+	if pageSize <= 0 {
+		return failure(codeInvalidArgument, "Page size must be greater than zero")
+	}
+	bookmark := args[2]
+
+	history, err := getHistory(stub, marbleName)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	start := 0
+	if bookmark != "" {
+		start = -1
+		for i, entry := range history {
+			if entry.TxId == bookmark {
+				start = i + 1
+				break
+			}
+		}
+		if start < 0 {
+			return failure(codeInvalidArgument, "Bookmark not found in the history of %s", marbleName)
+		}
+	}
+
+	end := start + int(pageSize)
+	if end > len(history) {
+		end = len(history)
+	}
+	page := history[start:end]
+
+	nextBookmark := bookmark
+	if len(page) > 0 {
+		nextBookmark = page[len(page)-1].TxId
+	}
+
+	historyAsBytes, err := json.Marshal(paginatedQueryResult{
+		Records:             page,
+		FetchedRecordsCount: int32(len(page)),
+		Bookmark:            nextBookmark,
+	})
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	fmt.Printf("- getHistoryForMarbleWithPagination returning:\n%s\n", historyAsBytes)
+
+	return success(json.RawMessage(historyAsBytes))
+}
+
+// ===========================================================================================
+// getHistory reads the history of a marble. If it was a delete operation on the marble the
+// Value of the entry is null, else it is the marble as it was written.
+// ===========================================================================================
+func getHistory(stub shim.ChaincodeStubInterface, marbleName string) ([]historyResult, error) {
 	resultsIterator, err := stub.GetHistoryForKey(marbleName)
 	if err != nil {
-		return shim.Error(err.Error())
+		return nil, err
 	}
 	defer resultsIterator.Close()
 
-	// buffer is a JSON array containing historic values for the marble
-	var buffer bytes.Buffer
-	buffer.WriteString("[")
-
-	bArrayMemberAlreadyWritten := false
+	history := []historyResult{}
 	for resultsIterator.HasNext() {
 		response, err := resultsIterator.Next()
 		if err != nil {
-			return shim.Error(err.Error())
+			return nil, err
 		}
-		// Add a comma before array members, suppress it for the first array member
-		if bArrayMemberAlreadyWritten == true {
-			buffer.WriteString(",")
+
+		entry := historyResult{
+			TxId:      response.TxId,
+			Timestamp: time.Unix(response.Timestamp.Seconds, int64(response.Timestamp.Nanos)).String(),
+			IsDelete:  response.IsDelete,
 		}
-		buffer.WriteString("{\"TxId\":")
-		buffer.WriteString("\"")
-		buffer.WriteString(response.TxId)
-		buffer.WriteString("\"")
-
-		buffer.WriteString(", \"Value\":")
-		// if it was a delete operation on given key, then we need to set the
-		//corresponding value null. Else, we will write the response.Value
-		//as-is (as the Value itself a JSON marble)
-		if response.IsDelete {
-			buffer.WriteString("null")
-		} else {
-			buffer.WriteString(string(response.Value))
+		if !response.IsDelete {
+			entry.Value = response.Value
 		}
-
-		buffer.WriteString(", \"Timestamp\":")
-		buffer.WriteString("\"")
-		buffer.WriteString(time.Unix(response.Timestamp.Seconds, int64(response.Timestamp.Nanos)).String())
-		buffer.WriteString("\"")
-
-		buffer.WriteString(", \"IsDelete\":")
-		buffer.WriteString("\"")
-		buffer.WriteString(strconv.FormatBool(response.IsDelete))
-		buffer.WriteString("\"")
-
-		buffer.WriteString("}")
-		bArrayMemberAlreadyWritten = true
+		history = append(history, entry)
 	}
-	buffer.WriteString("]")
-
-	fmt.Printf("- getHistoryForMarble returning:\n%s\n", buffer.String())
 
-	return shim.Success(buffer.Bytes())
+	return history, nil
 }
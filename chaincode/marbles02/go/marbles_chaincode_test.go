@@ -0,0 +1,357 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// decodePage decodes a paginated response, leaving its records in records
+func decodePage(t *testing.T, r response, records interface{}) paginatedQueryResult {
+	expectOK(t, r)
+	data, _ := json.Marshal(r.Data)
+	var page struct {
+		Records             json.RawMessage `json:"records"`
+		FetchedRecordsCount int32           `json:"fetchedRecordsCount"`
+		Bookmark            string          `json:"bookmark"`
+	}
+	if err := json.Unmarshal(data, &page); err != nil {
+		t.Fatalf("failed to decode page %s: %s", data, err)
+	}
+	if err := json.Unmarshal(page.Records, records); err != nil {
+		t.Fatalf("failed to decode records %s: %s", page.Records, err)
+	}
+	return paginatedQueryResult{Records: records, FetchedRecordsCount: page.FetchedRecordsCount, Bookmark: page.Bookmark}
+}
+
+// marblesOf returns the names of the marbles getMarblesByOwnerIndex finds for owner
+func marblesOf(t *testing.T, cc *SimpleChaincode, stub *fakeStub, owner string) []string {
+	var records []queryResult
+	decodePage(t, call(t, stub, cc.getMarblesByOwnerIndex, owner, "10", ""), &records)
+	names := []string{}
+	for _, record := range records {
+		names = append(names, record.Key)
+	}
+	return names
+}
+
+func TestGetMarblesByOwnerIndex(t *testing.T) {
+	cc, stub := newMarbleStub(t)
+	expectOK(t, call(t, stub, cc.initMarble, "marble2", "red", "50", "tom"))
+	expectOK(t, call(t, stub, cc.initMarble, "marble3", "red", "70", "jerry"))
+
+	var records []queryResult
+	page := decodePage(t, call(t, stub, cc.getMarblesByOwnerIndex, "Tom", "1", ""), &records)
+	if len(records) != 1 || records[0].Key != "marble1" || page.FetchedRecordsCount != 1 {
+		t.Fatalf("unexpected first page %+v", page)
+	}
+	var m marble
+	if err := json.Unmarshal(records[0].Record, &m); err != nil || m.Owner != "tom" || m.Color != "blue" {
+		t.Fatalf("unexpected marble %s", records[0].Record)
+	}
+
+	page = decodePage(t, call(t, stub, cc.getMarblesByOwnerIndex, "tom", "1", page.Bookmark), &records)
+	if len(records) != 1 || records[0].Key != "marble2" {
+		t.Fatalf("unexpected second page %+v", page)
+	}
+
+	page = decodePage(t, call(t, stub, cc.getMarblesByOwnerIndex, "tom", "1", page.Bookmark), &records)
+	if len(records) != 0 || page.FetchedRecordsCount != 0 {
+		t.Fatalf("expected an empty last page, got %+v", page)
+	}
+}
+
+func TestTransferMarble_MovesOwnerIndex(t *testing.T) {
+	cc, stub := newMarbleStub(t)
+	expectOK(t, call(t, stub, cc.transferMarble, "marble1", "Jerry"))
+
+	if names := marblesOf(t, cc, stub, "tom"); len(names) != 0 {
+		t.Fatalf("expected tom to own no marbles, got %v", names)
+	}
+	if names := marblesOf(t, cc, stub, "jerry"); !reflect.DeepEqual(names, []string{"marble1"}) {
+		t.Fatalf("expected jerry to own marble1, got %v", names)
+	}
+}
+
+func TestDelete_RemovesOwnerIndex(t *testing.T) {
+	cc, stub := newMarbleStub(t)
+	expectOK(t, call(t, stub, cc.delete, "marble1"))
+
+	ownerKey, _ := stub.CreateCompositeKey("owner~name", []string{"tom", "marble1"})
+	if stub.State[ownerKey] != nil {
+		t.Fatal("expected marble1 to be removed from the owner index of tom")
+	}
+	if names := marblesOf(t, cc, stub, "tom"); len(names) != 0 {
+		t.Fatalf("expected tom to own no marbles, got %v", names)
+	}
+}
+
+func TestInit_ReindexesOwners(t *testing.T) {
+	cc := new(SimpleChaincode)
+	stub := newFakeStub(cc)
+
+	// marble1 was created before the owner~name index was introduced
+	stub.MockTransactionStart("legacy")
+	err := stub.PutState("marble1", []byte(`{"docType":"marble","name":"marble1","color":"blue","size":35,"owner":"tom"}`))
+	if err != nil {
+		t.Fatalf("failed to put marble: %s", err)
+	}
+	stub.MockTransactionEnd("legacy")
+	expectOK(t, call(t, stub, cc.initMarble, "marble2", "red", "50", "tom"))
+	closeTime := auctionStart.Add(time.Hour).Format(time.RFC3339)
+	expectOK(t, call(t, stub, cc.openAuction, "marble2", "tom", "100", closeTime))
+
+	res := stub.MockInit("upgrade", [][]byte{[]byte("init")})
+	if res.Status != shim.OK {
+		t.Fatalf("Init failed: %s", res.Message)
+	}
+
+	if names := marblesOf(t, cc, stub, "tom"); !reflect.DeepEqual(names, []string{"marble1", "marble2"}) {
+		t.Fatalf("expected both marbles in the owner index of tom, got %v", names)
+	}
+
+	// the auction of marble2 and the index entries are not marbles
+	stub.MockTransactionStart("count")
+	defer stub.MockTransactionEnd("count")
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("owner~name", []string{})
+	if err != nil {
+		t.Fatalf("failed to read the owner index: %s", err)
+	}
+	defer resultsIterator.Close()
+	count := 0
+	for resultsIterator.HasNext() {
+		if _, err := resultsIterator.Next(); err != nil {
+			t.Fatalf("failed to read the owner index: %s", err)
+		}
+		count++
+	}
+	if count != 2 {
+		t.Fatalf("expected 2 owner index entries, got %d", count)
+	}
+}
+
+func TestPagination_PageSize(t *testing.T) {
+	cc := new(SimpleChaincode)
+	stub := newFakeStub(cc)
+
+	ownerQuery := `{"conditions":[{"field":"owner","operator":"$eq","value":"tom"}]}`
+	queries := map[string]struct {
+		fn   func(shim.ChaincodeStubInterface, []string) pb.Response
+		args func(pageSize string) []string
+	}{
+		"getMarblesByOwnerIndex":            {cc.getMarblesByOwnerIndex, func(pageSize string) []string { return []string{"tom", pageSize, ""} }},
+		"getMarblesByColorWithPagination":   {cc.getMarblesByColorWithPagination, func(pageSize string) []string { return []string{"blue", pageSize, ""} }},
+		"getHistoryForMarbleWithPagination": {cc.getHistoryForMarbleWithPagination, func(pageSize string) []string { return []string{"marble1", pageSize, ""} }},
+		"getMarblesByRangeWithPagination":   {cc.getMarblesByRangeWithPagination, func(pageSize string) []string { return []string{"marble1", "marble9", pageSize, ""} }},
+		"queryMarblesWithPagination":        {cc.queryMarblesWithPagination, func(pageSize string) []string { return []string{ownerQuery, pageSize, ""} }},
+	}
+	for name, query := range queries {
+		for _, pageSize := range []string{"0", "-1"} {
+			r := call(t, stub, query.fn, query.args(pageSize)...)
+			if r.OK || r.Code != codeInvalidArgument || r.Message != "Page size must be greater than zero" {
+				t.Fatalf("expected %s to reject page size %s, got %+v", name, pageSize, r)
+			}
+		}
+	}
+}
+
+func TestConstructPaginatedQueryResponse(t *testing.T) {
+	it := &stateIterator{kvs: []*queryresult.KV{
+		{Key: "marble1", Value: []byte(`{"name":"marble1"}`)},
+		{Key: "marble2", Value: []byte(`{"name":"marble2"}`)},
+	}}
+
+	responseAsBytes, err := constructPaginatedQueryResponse(it, &pb.QueryResponseMetadata{FetchedRecordsCount: 2, Bookmark: "marble2"})
+	if err != nil {
+		t.Fatalf("failed to construct the response: %s", err)
+	}
+
+	expected := `{"records":[{"Key":"marble1","Record":{"name":"marble1"}},{"Key":"marble2","Record":{"name":"marble2"}}],"fetchedRecordsCount":2,"bookmark":"marble2"}`
+	if string(responseAsBytes) != expected {
+		t.Fatalf("expected %s, got %s", expected, responseAsBytes)
+	}
+
+	// an empty page still has a records array
+	responseAsBytes, _ = constructPaginatedQueryResponse(&stateIterator{}, &pb.QueryResponseMetadata{})
+	if expected := `{"records":[],"fetchedRecordsCount":0,"bookmark":""}`; string(responseAsBytes) != expected {
+		t.Fatalf("expected %s, got %s", expected, responseAsBytes)
+	}
+}
+
+func TestGetMarblesByRangeWithPagination(t *testing.T) {
+	cc, stub := newMarbleStub(t)
+	expectOK(t, call(t, stub, cc.initMarble, "marble2", "red", "50", "tom"))
+	expectOK(t, call(t, stub, cc.initMarble, "marble3", "red", "70", "jerry"))
+
+	var records []queryResult
+	page := decodePage(t, call(t, stub, cc.getMarblesByRangeWithPagination, "marble1", "marble3", "1", ""), &records)
+	if len(records) != 1 || records[0].Key != "marble1" || page.FetchedRecordsCount != 1 || page.Bookmark != "marble1" {
+		t.Fatalf("unexpected first page %+v", page)
+	}
+
+	// the range is end exclusive
+	page = decodePage(t, call(t, stub, cc.getMarblesByRangeWithPagination, "marble1", "marble3", "5", page.Bookmark), &records)
+	if len(records) != 1 || records[0].Key != "marble2" || page.FetchedRecordsCount != 1 {
+		t.Fatalf("unexpected second page %+v", page)
+	}
+}
+
+func TestQueryMarblesWithPagination(t *testing.T) {
+	cc, stub := newMarbleStub(t)
+	expectOK(t, call(t, stub, cc.initMarble, "marble2", "red", "50", "tom"))
+	expectOK(t, call(t, stub, cc.initMarble, "marble3", "red", "70", "jerry"))
+
+	query := `{"conditions":[{"field":"owner","operator":"$eq","value":"Tom"}]}`
+	var records []queryResult
+	page := decodePage(t, call(t, stub, cc.queryMarblesWithPagination, query, "1", ""), &records)
+	if len(records) != 1 || records[0].Key != "marble1" || page.FetchedRecordsCount != 1 || page.Bookmark != "marble1" {
+		t.Fatalf("unexpected first page %+v", page)
+	}
+
+	page = decodePage(t, call(t, stub, cc.queryMarblesWithPagination, query, "5", page.Bookmark), &records)
+	if len(records) != 1 || records[0].Key != "marble2" || page.Bookmark != "marble2" {
+		t.Fatalf("unexpected second page %+v", page)
+	}
+
+	expectCode(t, call(t, stub, cc.queryMarblesWithPagination, `{"conditions":[{"field":"owner","operator":"$eq","value":"tom"}],"limit":5}`, "5", ""), codeInvalidQuery)
+}
+
+func TestGetHistoryForMarble(t *testing.T) {
+	cc, stub := newMarbleStub(t)
+	expectOK(t, call(t, stub, cc.transferMarble, "marble1", "jerry"))
+	expectOK(t, call(t, stub, cc.delete, "marble1"))
+
+	r := call(t, stub, cc.getHistoryForMarble, "marble1")
+	expectOK(t, r)
+	data, _ := json.Marshal(r.Data)
+	var history []historyResult
+	if err := json.Unmarshal(data, &history); err != nil {
+		t.Fatalf("failed to decode history %s: %s", data, err)
+	}
+
+	// the peer returns the newest change first, and a delete has no value
+	if len(history) != 3 || !history[0].IsDelete || string(history[0].Value) != "null" || history[1].IsDelete {
+		t.Fatalf("unexpected history %s", data)
+	}
+	for i, owner := range []string{"jerry", "tom"} {
+		var m marble
+		if err := json.Unmarshal(history[i+1].Value, &m); err != nil || m.Owner != owner {
+			t.Fatalf("expected %s to own marble1, got %s", owner, history[i+1].Value)
+		}
+	}
+}
+
+func TestGetHistoryForMarbleWithPagination(t *testing.T) {
+	cc, stub := newMarbleStub(t)
+	expectOK(t, call(t, stub, cc.transferMarble, "marble1", "jerry"))
+	expectOK(t, call(t, stub, cc.transferMarble, "marble1", "alice"))
+
+	var history []historyResult
+	page := decodePage(t, call(t, stub, cc.getHistoryForMarbleWithPagination, "marble1", "2", ""), &history)
+	if len(history) != 2 || page.FetchedRecordsCount != 2 || page.Bookmark != history[1].TxId {
+		t.Fatalf("unexpected first page %+v", page)
+	}
+	firstPage := history
+
+	page = decodePage(t, call(t, stub, cc.getHistoryForMarbleWithPagination, "marble1", "2", page.Bookmark), &history)
+	if len(history) != 1 || page.FetchedRecordsCount != 1 || history[0].TxId == firstPage[1].TxId {
+		t.Fatalf("unexpected second page %+v", page)
+	}
+
+	// the last page keeps the bookmark, so paging on returns nothing
+	page = decodePage(t, call(t, stub, cc.getHistoryForMarbleWithPagination, "marble1", "2", page.Bookmark), &history)
+	if len(history) != 0 || page.FetchedRecordsCount != 0 {
+		t.Fatalf("expected an empty last page, got %+v", page)
+	}
+
+	expectCode(t, call(t, stub, cc.getHistoryForMarbleWithPagination, "marble1", "2", "unknown"), codeInvalidArgument)
+}
+
+// transferByColor runs transferMarblesBasedOnColor and decodes its summary
+func transferByColor(t *testing.T, cc *SimpleChaincode, stub *fakeStub, args ...string) transferSummary {
+	r := call(t, stub, cc.transferMarblesBasedOnColor, args...)
+	expectOK(t, r)
+	data, _ := json.Marshal(r.Data)
+	var summary transferSummary
+	if err := json.Unmarshal(data, &summary); err != nil {
+		t.Fatalf("failed to decode summary %s: %s", data, err)
+	}
+	return summary
+}
+
+func TestTransferMarblesBasedOnColor_MaxCount(t *testing.T) {
+	cc, stub := newMarbleStub(t)
+	expectOK(t, call(t, stub, cc.initMarble, "marble2", "blue", "50", "tom"))
+	expectOK(t, call(t, stub, cc.initMarble, "marble3", "blue", "70", "jerry"))
+
+	summary := transferByColor(t, cc, stub, "blue", "alice", "2")
+	if !reflect.DeepEqual(summary.Marbles, []string{"marble1", "marble2"}) || !summary.HasMore {
+		t.Fatalf("unexpected summary %+v", summary)
+	}
+	if owner := readOwner(t, cc, stub, "marble3"); owner != "jerry" {
+		t.Fatalf("expected jerry to keep marble3, got %s", owner)
+	}
+
+	summary = transferByColor(t, cc, stub, "blue", "bob", "3")
+	if len(summary.Marbles) != 3 || summary.HasMore {
+		t.Fatalf("unexpected summary %+v", summary)
+	}
+}
+
+func TestTransferMarblesBasedOnColor_MaxCountSkipsLocked(t *testing.T) {
+	cc, stub := newMarbleStub(t)
+	expectOK(t, call(t, stub, cc.initMarble, "marble2", "blue", "50", "tom"))
+	expectOK(t, call(t, stub, cc.openAuction, "marble2", "tom", "100", auctionStart.Add(time.Hour).Format(time.RFC3339)))
+
+	// the only marble past the limit is locked, so none is left to transfer
+	summary := transferByColor(t, cc, stub, "blue", "alice", "1")
+	if !reflect.DeepEqual(summary.Marbles, []string{"marble1"}) || !reflect.DeepEqual(summary.Locked, []string{"marble2"}) || summary.HasMore {
+		t.Fatalf("unexpected summary %+v", summary)
+	}
+}
+
+func TestTransferMarblesBasedOnColor_OwnerFilter(t *testing.T) {
+	cc, stub := newMarbleStub(t)
+	expectOK(t, call(t, stub, cc.initMarble, "marble2", "blue", "50", "jerry"))
+	expectOK(t, call(t, stub, cc.initMarble, "marble3", "red", "70", "jerry"))
+
+	summary := transferByColor(t, cc, stub, "blue", "alice", "", "", "Jerry")
+	if !reflect.DeepEqual(summary.Marbles, []string{"marble2"}) {
+		t.Fatalf("unexpected summary %+v", summary)
+	}
+
+	for name, owner := range map[string]string{"marble1": "tom", "marble2": "alice", "marble3": "jerry"} {
+		if got := readOwner(t, cc, stub, name); got != owner {
+			t.Fatalf("expected %s to own %s, got %s", owner, name, got)
+		}
+	}
+}
+
+func TestTransferMarblesBasedOnColor_SkipsLocked(t *testing.T) {
+	cc, stub := newMarbleStub(t)
+	expectOK(t, call(t, stub, cc.initMarble, "marble2", "blue", "50", "tom"))
+	expectOK(t, call(t, stub, cc.initMarble, "marble3", "blue", "70", "jerry"))
+	openTestAuction(t, cc, stub, "100")
+
+	for _, dryRun := range []string{"true", "false"} {
+		summary := transferByColor(t, cc, stub, "blue", "alice", "", dryRun)
+		if !reflect.DeepEqual(summary.Marbles, []string{"marble2", "marble3"}) || !reflect.DeepEqual(summary.Locked, []string{"marble1"}) {
+			t.Fatalf("unexpected summary %+v", summary)
+		}
+	}
+
+	for name, owner := range map[string]string{"marble1": "tom", "marble2": "alice", "marble3": "alice"} {
+		if got := readOwner(t, cc, stub, name); got != owner {
+			t.Fatalf("expected %s to own %s, got %s", owner, name, got)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// ==== Structured rich queries ===============================================================
+// Clients do not pass CouchDB query strings to the chaincode. A query is instead described as
+// a list of conditions, each a field, an operator and a value, plus an optional sort and limit:
+//
+//   {"conditions":[{"field":"owner","operator":"$eq","value":"tom"},
+//                  {"field":"size","operator":"$gt","value":10}],
+//    "sort":[{"field":"size","direction":"desc"}],
+//    "limit":10}
+//
+// Only whitelisted fields and operators are accepted, and the selector is built with
+// json.Marshal, so client input can never change the shape of the query. The query is always
+// restricted to marbles, and must be served by one of the indexes packaged with the chaincode
+// in META-INF/statedb/couchdb/indexes, which is named in use_index. Queries that would need a
+// full scan of the state database are rejected.
+// ============================================================================================
+
+// queryFields maps each field a query may filter or sort on to the JSON type of its value
+var queryFields = map[string]string{
+	"name":  "string",
+	"color": "string",
+	"size":  "number",
+	"owner": "string",
+}
+
+// queryOperators is the set of CouchDB operators a query condition may use
+var queryOperators = map[string]bool{
+	"$eq":  true,
+	"$ne":  true,
+	"$gt":  true,
+	"$gte": true,
+	"$lt":  true,
+	"$lte": true,
+}
+
+// couchIndex describes an index packaged in META-INF/statedb/couchdb/indexes
+type couchIndex struct {
+	DesignDoc string
+	Name      string
+	Fields    []string
+	Direction string
+}
+
+// declaredIndexes must be kept in step with the index definitions in META-INF
+var declaredIndexes = []couchIndex{
+	{DesignDoc: "indexOwnerDoc", Name: "indexOwner", Fields: []string{"docType", "owner"}, Direction: "asc"},
+	{DesignDoc: "indexNameDoc", Name: "indexName", Fields: []string{"docType", "name"}, Direction: "asc"},
+	{DesignDoc: "indexColorDoc", Name: "indexColor", Fields: []string{"docType", "color"}, Direction: "asc"},
+	{DesignDoc: "indexSizeSortDoc", Name: "indexSizeSortDesc", Fields: []string{"size", "docType", "owner"}, Direction: "desc"},
+}
+
+type queryCondition struct {
+	Field    string      `json:"field"`
+	Operator string      `json:"operator"`
+	Value    interface{} `json:"value"`
+}
+
+type querySort struct {
+	Field     string `json:"field"`
+	Direction string `json:"direction"`
+}
+
+type marbleQuery struct {
+	Conditions []queryCondition `json:"conditions"`
+	Sort       []querySort      `json:"sort"`
+	Limit      int              `json:"limit"`
+}
+
+// couchQuery is the CouchDB query built from a marbleQuery
+type couchQuery struct {
+	Selector map[string]map[string]interface{} `json:"selector"`
+	Sort     []map[string]string               `json:"sort,omitempty"`
+	Limit    int                               `json:"limit,omitempty"`
+	UseIndex []string                          `json:"use_index"`
+}
+
+// parseMarbleQuery decodes a structured query sent by a client
+func parseMarbleQuery(queryJSON string) (marbleQuery, error) {
+	var query marbleQuery
+	decoder := json.NewDecoder(bytes.NewReader([]byte(queryJSON)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&query); err != nil {
+		return query, newError(codeInvalidQuery, "Failed to decode query: %s", err.Error())
+	}
+	return query, nil
+}
+
+// buildQueryString validates a structured query and builds the CouchDB query string for it.
+// Paginated queries take their limit from the page size, so a query limit is rejected.
+func buildQueryString(query marbleQuery, paginated bool) (string, error) {
+	if len(query.Conditions) == 0 {
+		return "", newError(codeInvalidQuery, "Query must have at least one condition")
+	}
+	if query.Limit < 0 {
+		return "", newError(codeInvalidQuery, "Query limit must not be negative")
+	}
+	if paginated && query.Limit != 0 {
+		return "", newError(codeInvalidQuery, "Paginated queries take their limit from the page size")
+	}
+
+	selector := map[string]map[string]interface{}{
+		"docType": {"$eq": "marble"},
+	}
+	// indexable holds the fields with a condition an index can serve; $ne cannot be
+	indexable := map[string]bool{"docType": true}
+	for _, condition := range query.Conditions {
+		fieldType, ok := queryFields[condition.Field]
+		if !ok {
+			return "", newError(codeInvalidQuery, "Field %q cannot be queried", condition.Field)
+		}
+		if !queryOperators[condition.Operator] {
+			return "", newError(codeInvalidQuery, "Operator %q is not supported", condition.Operator)
+		}
+
+		value := condition.Value
+		switch v := value.(type) {
+		case string:
+			if fieldType != "string" {
+				return "", newError(codeInvalidQuery, "Field %s must be compared with a %s", condition.Field, fieldType)
+			}
+			// colors and owners are stored in lower case
+			if condition.Field == "color" || condition.Field == "owner" {
+				value = strings.ToLower(v)
+			}
+		case float64:
+			if fieldType != "number" {
+				return "", newError(codeInvalidQuery, "Field %s must be compared with a %s", condition.Field, fieldType)
+			}
+		default:
+			return "", newError(codeInvalidQuery, "Field %s must be compared with a %s", condition.Field, fieldType)
+		}
+
+		if selector[condition.Field] == nil {
+			selector[condition.Field] = map[string]interface{}{}
+		}
+		if _, ok := selector[condition.Field][condition.Operator]; ok {
+			return "", newError(codeInvalidQuery, "Operator %s is used more than once on field %s", condition.Operator, condition.Field)
+		}
+		selector[condition.Field][condition.Operator] = value
+		if condition.Operator != "$ne" {
+			indexable[condition.Field] = true
+		}
+	}
+
+	var sort []map[string]string
+	for _, s := range query.Sort {
+		if _, ok := queryFields[s.Field]; !ok {
+			return "", newError(codeInvalidQuery, "Field %q cannot be sorted on", s.Field)
+		}
+		if s.Direction != "asc" && s.Direction != "desc" {
+			return "", newError(codeInvalidQuery, "Sort direction must be asc or desc, not %q", s.Direction)
+		}
+		sort = append(sort, map[string]string{s.Field: s.Direction})
+	}
+
+	index, err := findIndex(indexable, query.Sort)
+	if err != nil {
+		return "", err
+	}
+
+	queryAsBytes, err := json.Marshal(couchQuery{
+		Selector: selector,
+		Sort:     sort,
+		Limit:    query.Limit,
+		UseIndex: []string{"_design/" + index.DesignDoc, index.Name},
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(queryAsBytes), nil
+}
+
+// findIndex returns the first declared index that can serve a query. Every field of the index
+// must have an indexable condition, and any sort must follow the leading fields of the index
+// in the direction of the index.
+func findIndex(indexable map[string]bool, sort []querySort) (couchIndex, error) {
+	for _, index := range declaredIndexes {
+		if canServe(index, indexable, sort) {
+			return index, nil
+		}
+	}
+	return couchIndex{}, newError(codeInvalidQuery, "Query would not use a declared index")
+}
+
+func canServe(index couchIndex, indexable map[string]bool, sort []querySort) bool {
+	for _, field := range index.Fields {
+		if !indexable[field] {
+			return false
+		}
+	}
+	if len(sort) > len(index.Fields) {
+		return false
+	}
+	for i, s := range sort {
+		if s.Field != index.Fields[i] || s.Direction != index.Direction {
+			return false
+		}
+	}
+	return true
+}
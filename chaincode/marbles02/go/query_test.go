@@ -0,0 +1,204 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// buildQuery parses and builds a query, returning the error code if it is rejected
+func buildQuery(t *testing.T, queryJSON string, paginated bool) (map[string]interface{}, errorCode) {
+	query, err := parseMarbleQuery(queryJSON)
+	if err == nil {
+		var queryString string
+		queryString, err = buildQueryString(query, paginated)
+		if err == nil {
+			var built map[string]interface{}
+			if err := json.Unmarshal([]byte(queryString), &built); err != nil {
+				t.Fatalf("built query %s is not valid JSON: %s", queryString, err)
+			}
+			return built, ""
+		}
+	}
+	e, ok := err.(*marbleError)
+	if !ok {
+		t.Fatalf("expected a marbleError, got %v", err)
+	}
+	return nil, e.Code
+}
+
+func TestBuildQueryString(t *testing.T) {
+	built, code := buildQuery(t, `{"conditions":[{"field":"owner","operator":"$eq","value":"Tom"},{"field":"size","operator":"$gt","value":10}],"sort":[{"field":"size","direction":"desc"}],"limit":10}`, false)
+	if code != "" {
+		t.Fatalf("expected the query to be accepted, got %s", code)
+	}
+
+	expected := map[string]interface{}{
+		"selector": map[string]interface{}{
+			"docType": map[string]interface{}{"$eq": "marble"},
+			"owner":   map[string]interface{}{"$eq": "tom"},
+			"size":    map[string]interface{}{"$gt": float64(10)},
+		},
+		"sort":      []interface{}{map[string]interface{}{"size": "desc"}},
+		"limit":     float64(10),
+		"use_index": []interface{}{"_design/indexSizeSortDoc", "indexSizeSortDesc"},
+	}
+	if !reflect.DeepEqual(built, expected) {
+		t.Fatalf("unexpected query %v", built)
+	}
+}
+
+func TestBuildQueryString_Injection(t *testing.T) {
+	// a value is always a literal, however much it looks like a selector
+	value := `tom"},"$or":[{"docType":{"$gt":null}}],"x":{"$eq":"`
+	query := marbleQuery{Conditions: []queryCondition{{Field: "owner", Operator: "$eq", Value: value}}}
+	queryString, err := buildQueryString(query, false)
+	if err != nil {
+		t.Fatalf("expected the query to be accepted, got %s", err)
+	}
+	var built couchQuery
+	if err := json.Unmarshal([]byte(queryString), &built); err != nil {
+		t.Fatalf("built query %s is not valid JSON: %s", queryString, err)
+	}
+	if len(built.Selector) != 2 || built.Selector["owner"]["$eq"] != strings.ToLower(value) {
+		t.Fatalf("expected the value to be kept as a literal, got %s", queryString)
+	}
+
+	injections := []string{
+		// operators and fields cannot be smuggled in through a value
+		`{"conditions":[{"field":"owner","operator":"$eq","value":{"$gt":null}}]}`,
+		`{"conditions":[{"field":"owner","operator":"$eq","value":["tom"]}]}`,
+		// nor in place of a field or operator
+		`{"conditions":[{"field":"$or","operator":"$eq","value":"tom"}]}`,
+		`{"conditions":[{"field":"owner","operator":"$regex","value":".*"}]}`,
+		`{"conditions":[{"field":"owner","operator":"$where","value":"1"}]}`,
+		// nor as extra query members
+		`{"selector":{"docType":"marble"},"conditions":[{"field":"owner","operator":"$eq","value":"tom"}]}`,
+		`{"conditions":[{"field":"owner","operator":"$eq","value":"tom"}],"use_index":["_design/other"]}`,
+		`not a query`,
+	}
+	for _, queryJSON := range injections {
+		if _, code := buildQuery(t, queryJSON, false); code != codeInvalidQuery {
+			t.Fatalf("expected %s to be rejected, got %q", queryJSON, code)
+		}
+	}
+}
+
+func TestBuildQueryString_Whitelist(t *testing.T) {
+	rejected := []string{
+		`{"conditions":[{"field":"docType","operator":"$eq","value":"auction"}]}`,
+		`{"conditions":[{"field":"seller","operator":"$eq","value":"tom"}]}`,
+		`{"conditions":[{"field":"owner","operator":"$eq","value":"tom"}],"sort":[{"field":"reservePrice","direction":"asc"}]}`,
+		`{"conditions":[{"field":"owner","operator":"$eq","value":"tom"}],"sort":[{"field":"owner","direction":"up"}]}`,
+		`{"conditions":[{"field":"size","operator":"$eq","value":"big"}]}`,
+		`{"conditions":[{"field":"owner","operator":"$eq","value":10}]}`,
+		`{"conditions":[{"field":"owner","operator":"$eq","value":"tom"},{"field":"owner","operator":"$eq","value":"jerry"}]}`,
+		`{"conditions":[]}`,
+		`{"conditions":[{"field":"owner","operator":"$eq","value":"tom"}],"limit":-1}`,
+	}
+	for _, queryJSON := range rejected {
+		if _, code := buildQuery(t, queryJSON, false); code != codeInvalidQuery {
+			t.Fatalf("expected %s to be rejected, got %q", queryJSON, code)
+		}
+	}
+
+	// paginated queries take their limit from the page size
+	limited := `{"conditions":[{"field":"owner","operator":"$eq","value":"tom"}],"limit":5}`
+	if _, code := buildQuery(t, limited, false); code != "" {
+		t.Fatalf("expected %s to be accepted, got %s", limited, code)
+	}
+	if _, code := buildQuery(t, limited, true); code != codeInvalidQuery {
+		t.Fatalf("expected %s to be rejected when paginated, got %q", limited, code)
+	}
+}
+
+func TestBuildQueryString_Indexes(t *testing.T) {
+	tests := []struct {
+		query string
+		index string
+	}{
+		{`{"conditions":[{"field":"owner","operator":"$eq","value":"tom"}]}`, "indexOwner"},
+		{`{"conditions":[{"field":"name","operator":"$eq","value":"marble1"}]}`, "indexName"},
+		{`{"conditions":[{"field":"color","operator":"$eq","value":"blue"}]}`, "indexColor"},
+		{`{"conditions":[{"field":"color","operator":"$eq","value":"blue"},{"field":"size","operator":"$ne","value":10}]}`, "indexColor"},
+		{`{"conditions":[{"field":"owner","operator":"$gte","value":"a"},{"field":"size","operator":"$lt","value":50}],"sort":[{"field":"size","direction":"desc"}]}`, "indexSizeSortDesc"},
+		// no index serves these, so they would scan the whole state database
+		{`{"conditions":[{"field":"size","operator":"$gt","value":10}]}`, ""},
+		{`{"conditions":[{"field":"owner","operator":"$ne","value":"tom"}]}`, ""},
+		{`{"conditions":[{"field":"owner","operator":"$eq","value":"tom"}],"sort":[{"field":"size","direction":"asc"}]}`, ""},
+		{`{"conditions":[{"field":"owner","operator":"$eq","value":"tom"},{"field":"size","operator":"$gt","value":10}],"sort":[{"field":"size","direction":"asc"}]}`, ""},
+	}
+	for _, tt := range tests {
+		built, code := buildQuery(t, tt.query, false)
+		if tt.index == "" {
+			if code != codeInvalidQuery {
+				t.Fatalf("expected %s to be rejected, got %v", tt.query, built)
+			}
+			continue
+		}
+		if code != "" {
+			t.Fatalf("expected %s to be accepted, got %s", tt.query, code)
+		}
+		useIndex := built["use_index"].([]interface{})
+		if useIndex[1] != tt.index {
+			t.Fatalf("expected %s to use %s, got %v", tt.query, tt.index, useIndex)
+		}
+	}
+}
+
+// TestDeclaredIndexes checks declaredIndexes against the index definitions packaged in META-INF
+func TestDeclaredIndexes(t *testing.T) {
+	files, err := filepath.Glob("META-INF/statedb/couchdb/indexes/*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	packaged := map[string]couchIndex{}
+	for _, file := range files {
+		indexAsBytes, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var definition struct {
+			Index struct {
+				Fields []interface{} `json:"fields"`
+			} `json:"index"`
+			DesignDoc string `json:"ddoc"`
+			Name      string `json:"name"`
+		}
+		if err := json.Unmarshal(indexAsBytes, &definition); err != nil {
+			t.Fatalf("failed to decode %s: %s", file, err)
+		}
+
+		// fields are either names, sorted ascending, or {name: direction}
+		index := couchIndex{DesignDoc: definition.DesignDoc, Name: definition.Name, Direction: "asc"}
+		for _, field := range definition.Index.Fields {
+			switch f := field.(type) {
+			case string:
+				index.Fields = append(index.Fields, f)
+			case map[string]interface{}:
+				for name, direction := range f {
+					index.Fields = append(index.Fields, name)
+					index.Direction = direction.(string)
+				}
+			}
+		}
+		packaged[index.Name] = index
+	}
+
+	if len(packaged) != len(declaredIndexes) {
+		t.Fatalf("expected %d packaged indexes, found %d", len(declaredIndexes), len(packaged))
+	}
+	for _, index := range declaredIndexes {
+		if !reflect.DeepEqual(packaged[index.Name], index) {
+			t.Fatalf("declared index %+v does not match the packaged %+v", index, packaged[index.Name])
+		}
+	}
+}
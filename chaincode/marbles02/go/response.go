@@ -0,0 +1,85 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// ==== Responses =============================================================================
+// Every function returns the same JSON envelope:
+//
+//   {"ok":true,"data":{...}}
+//   {"ok":false,"code":"MARBLE_NOT_FOUND","message":"Marble does not exist: marble1"}
+//
+// Successful responses carry the envelope as the payload. Failed responses carry it as the
+// message of shim.Error, so the transaction is still rejected by the peer.
+// ============================================================================================
+
+type errorCode string
+
+// Error codes returned to clients
+const (
+	codeInvalidArgument errorCode = "INVALID_ARGUMENT"
+	codeInvalidMarble   errorCode = "INVALID_MARBLE"
+	codeInvalidQuery    errorCode = "INVALID_QUERY"
+	codeMarbleExists    errorCode = "MARBLE_EXISTS"
+	codeMarbleNotFound  errorCode = "MARBLE_NOT_FOUND"
+	codeMarbleLocked    errorCode = "MARBLE_LOCKED"
+	codeNotOwner        errorCode = "NOT_OWNER"
+	codeAuctionNotFound errorCode = "AUCTION_NOT_FOUND"
+	codeAuctionState    errorCode = "AUCTION_STATE"
+	codeUnknownFunction errorCode = "UNKNOWN_FUNCTION"
+	codeInternal        errorCode = "INTERNAL"
+)
+
+type response struct {
+	OK      bool        `json:"ok"`
+	Code    errorCode   `json:"code,omitempty"`
+	Message string      `json:"message,omitempty"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// marbleError is an error with the code reported to the client
+type marbleError struct {
+	Code    errorCode
+	Message string
+}
+
+func (e *marbleError) Error() string {
+	return e.Message
+}
+
+func newError(code errorCode, format string, args ...interface{}) *marbleError {
+	return &marbleError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// success returns data in a successful response. JSON already read from state or built by a
+// query can be passed in as a json.RawMessage
+func success(data interface{}) pb.Response {
+	responseAsBytes, err := json.Marshal(response{OK: true, Data: data})
+	if err != nil {
+		return failure(codeInternal, "%s", err.Error())
+	}
+	return shim.Success(responseAsBytes)
+}
+
+// failure returns a failed response with the given code and message
+func failure(code errorCode, format string, args ...interface{}) pb.Response {
+	responseAsBytes, _ := json.Marshal(response{Code: code, Message: fmt.Sprintf(format, args...)})
+	return shim.Error(string(responseAsBytes))
+}
+
+// errorResponse returns a failed response for err, keeping its code if it has one
+func errorResponse(err error) pb.Response {
+	if e, ok := err.(*marbleError); ok {
+		return failure(e.Code, "%s", e.Message)
+	}
+	return failure(codeInternal, "%s", err.Error())
+}
@@ -18,6 +18,11 @@ public class ClientApp {
 		System.setProperty("org.hyperledger.fabric.sdk.service_discovery.as_localhost", "true");
 	}
 
+	// The client identity of the new owner, as the chaincode reads it: the
+	// base64 encoding of "x509::<subject DN>::<issuer DN>" of their certificate.
+	// Only a client with this identity can accept the transfer.
+	private static final String ARCHIE_ID = "eDUwOTo6Q049YXJjaGllOjpDTj1jYS5vcmcxLmV4YW1wbGUuY29t";
+
 	public static void main(String[] args) throws Exception {
 		// Load a file system based wallet for managing identities.
 		Path walletPath = Paths.get("wallet");
@@ -41,14 +46,17 @@ public class ClientApp {
 			result = contract.evaluateTransaction("queryAllCars");
 			System.out.println(new String(result));
 
-			contract.submitTransaction("createCar", "CAR10", "VW", "Polo", "Grey", "Mary");
+			contract.submitTransaction("createCar", "CAR10", "VW", "Polo", "Grey", "Mary", "WVWZZZ6R69Y000011");
 
 			result = contract.evaluateTransaction("queryCar", "CAR10");
 			System.out.println(new String(result));
 
-			contract.submitTransaction("changeCarOwner", "CAR10", "Archie");
+			// a car must be listed for sale before it is offered to a new owner
+			contract.submitTransaction("listForSale", "CAR10");
+			contract.submitTransaction("changeCarOwner", "CAR10", "Archie", ARCHIE_ID, "1000");
 
-			result = contract.evaluateTransaction("queryCar", "CAR10");
+			// the car changes hands once Archie calls acceptCarTransfer
+			result = contract.evaluateTransaction("queryCarTransfer", "CAR10");
 			System.out.println(new String(result));
 		}
 	}
@@ -34,9 +34,10 @@ async function main() {
         const contract = network.getContract('fabcar');
 
         // Submit the specified transaction.
-        // createCar transaction - requires 5 argument, ex: ('createCar', 'CAR12', 'Honda', 'Accord', 'Black', 'Tom')
-        // changeCarOwner transaction - requires 2 args , ex: ('changeCarOwner', 'CAR10', 'Dave')
-        await contract.submitTransaction('createCar', 'CAR12', 'Honda', 'Accord', 'Black', 'Tom');
+        // createCar transaction - requires 6 arguments, ex: ('createCar', 'CAR12', 'Honda', 'Accord', 'Black', 'Tom', '1HGCP26330A000012')
+        // changeCarOwner transaction - requires 4 args, ex: ('changeCarOwner', 'CAR10', 'Dave', '<client identity of Dave>', '1000')
+        // the car must first be listed with listForSale, and changes hands once Dave calls acceptCarTransfer
+        await contract.submitTransaction('createCar', 'CAR12', 'Honda', 'Accord', 'Black', 'Tom', '1HGCP26330A000012');
         console.log(`Transaction has been submitted`);
 
         // Disconnect from the gateway.